@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/TheJa750/Chirpy/internal/database"
+	"github.com/TheJa750/Chirpy/internal/mailer"
+	"github.com/google/uuid"
+)
+
+var errAccountPendingDeletion = errors.New("account is scheduled for deletion")
+
+// deleteUserHandler disables the caller's account straight away and leaves
+// it for purgeDeletedAccounts to remove once the grace period has passed.
+// Until then the user can get it back through cancelDeletionHandler.
+func (a *apiConfig) deleteUserHandler(w http.ResponseWriter, req *http.Request) {
+	user, err := a.authenticateSession(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		respondAuthError(w, err)
+		return
+	}
+
+	var deletionReq AccountDeletionRequest
+	decoder := json.NewDecoder(req.Body)
+	err = decoder.Decode(&deletionReq)
+	if err != nil {
+		log.Printf("Error decoding account deletion request: %s", err)
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if deletionReq.Password == "" {
+		http.Error(w, "Password is required", http.StatusBadRequest)
+		return
+	}
+
+	if !a.verifyCurrentCredentials(w, req, user, deletionReq.Password, deletionReq.Code) {
+		return
+	}
+
+	// Marking the account and disabling it happen together, so a failure
+	// can't leave an account scheduled for deletion with its chirps and
+	// tokens still live.
+	tx, err := a.db.BeginTx(req.Context(), nil)
+	if err != nil {
+		log.Printf("Error starting transaction: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	qtx := a.dbQueries.WithTx(tx)
+
+	user, err = qtx.RequestUserDeletion(req.Context(), user.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Account is already scheduled for deletion", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error requesting account deletion: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	err = disableAccount(req.Context(), qtx, user.ID)
+	if err != nil {
+		log.Printf("Error disabling account: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("Error committing account deletion: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	deleteAfter := user.DeletionRequestedAt.Time.Add(a.DeletionGracePeriod)
+
+	err = a.Mailer.Send(req.Context(), mailer.Message{
+		To:      user.Email,
+		Subject: "Your Chirpy account will be deleted",
+		Body: fmt.Sprintf("Your Chirpy account has been disabled and will be deleted permanently after %s.\n\n"+
+			"Changed your mind? Send your email and password to POST /api/users/cancel-deletion before then "+
+			"to get your account back.\n", deleteAfter.Format(time.RFC1123)),
+	})
+	if err != nil {
+		log.Printf("Error sending account deletion email: %s", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(AccountDeletion{DeleteAfter: deleteAfter})
+}
+
+// disableAccount hides the user's chirps and signs out every session, app
+// and personal access token.
+func disableAccount(ctx context.Context, q *database.Queries, userID uuid.UUID) error {
+	err := q.HideUserChirps(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	return revokeAllCredentials(ctx, q, userID)
+}
+
+// cancelDeletionHandler restores an account within its grace period. Login
+// is blocked and every token revoked once deletion is requested, so the user
+// proves who they are with their credentials, and gets a new session back.
+func (a *apiConfig) cancelDeletionHandler(w http.ResponseWriter, req *http.Request) {
+	var cancelReq CancelDeletionRequest
+	decoder := json.NewDecoder(req.Body)
+	err := decoder.Decode(&cancelReq)
+	if err != nil {
+		log.Printf("Error decoding cancel deletion request: %s", err)
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if cancelReq.Email == "" || cancelReq.Password == "" {
+		http.Error(w, "Email and password are required", http.StatusBadRequest)
+		return
+	}
+
+	if !a.startLoginAttempt(w, req, cancelReq.Email) {
+		return
+	}
+
+	user, err := a.dbQueries.GetUserByEmail(req.Context(), cancelReq.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		a.recordLoginFailure(req, cancelReq.Email, uuid.NullUUID{}, loginFailureUnknownEmail)
+		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting user by email: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if !a.checkCredentials(w, req, user, cancelReq.Password, cancelReq.Code) {
+		return
+	}
+
+	if !user.DeletionRequestedAt.Valid {
+		http.Error(w, "Account is not scheduled for deletion", http.StatusConflict)
+		return
+	}
+
+	tx, err := a.db.BeginTx(req.Context(), nil)
+	if err != nil {
+		log.Printf("Error starting transaction: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	qtx := a.dbQueries.WithTx(tx)
+
+	user, err = qtx.CancelUserDeletion(req.Context(), user.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Account is not scheduled for deletion", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error cancelling account deletion: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Chirps only come back once the account is no longer pending deletion,
+	// so rechirps are left hidden while the other side is still going away.
+	err = qtx.RestoreUserChirps(req.Context(), user.ID)
+	if err != nil {
+		log.Printf("Error restoring chirps: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("Error committing deletion cancellation: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	a.respondWithLogin(w, req, user)
+}
+
+// purgeDeletedAccounts removes accounts whose grace period has passed, every
+// interval until ctx is done. Chirps, sessions and everything else owned by
+// the account go with it through ON DELETE CASCADE. It is safe to run on
+// every instance at once, since each purge is a single DELETE.
+func (a *apiConfig) purgeDeletedAccounts(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := a.dbQueries.PurgeDeletedUsers(ctx, int32(a.DeletionGracePeriod/time.Second))
+		if err != nil {
+			log.Printf("Error purging deleted accounts: %s", err)
+		} else if purged > 0 {
+			log.Printf("Purged %d deleted accounts", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -1,10 +1,10 @@
 package main
 
 import (
+	"database/sql"
 	"encoding/json"
 	"log"
 	"net/http"
-	"sort"
 	"strings"
 
 	"github.com/TheJa750/Chirpy/internal/auth"
@@ -40,6 +40,52 @@ func cleanChirpBody(s string) CleanedChirpBody {
 	return CleanedChirpBody{cleanBody}
 }
 
+// chirpFromDB converts a database row into the JSON shape returned to clients.
+// Tombstoned chirps keep their place in a thread but carry no body.
+// Rechirp and quote references only carry an ID until prepareChirps fills
+// them in.
+func chirpFromDB(chirp database.Chirp) Chirp {
+	jsonChirp := Chirp{
+		ID:         chirp.ID,
+		Body:       chirp.Body,
+		CreatedAt:  chirp.CreatedAt.Time,
+		UpdatedAt:  chirp.UpdatedAt.Time,
+		UserID:     chirp.UserID,
+		ReplyCount: chirp.ReplyCount,
+		LikeCount:  chirp.LikeCount,
+		Deleted:    chirp.DeletedAt.Valid,
+	}
+	if chirp.DeletedAt.Valid {
+		jsonChirp.Body = ""
+	}
+	if chirp.ParentID.Valid {
+		jsonChirp.InReplyTo = &chirp.ParentID.UUID
+	}
+	if chirp.RechirpOfID.Valid {
+		jsonChirp.RechirpOf = &Chirp{ID: chirp.RechirpOfID.UUID}
+	}
+	if chirp.QuoteOfID.Valid {
+		jsonChirp.QuoteOf = &Chirp{ID: chirp.QuoteOfID.UUID}
+	}
+	return jsonChirp
+}
+
+// prepareChirps fills in the parts of the response that need extra lookups:
+// the chirps referenced by rechirps and quotes and, for authenticated callers,
+// whether they have liked each chirp.
+func (a *apiConfig) prepareChirps(req *http.Request, chirps []*Chirp) error {
+	embedded, err := a.embedReferencedChirps(req.Context(), chirps)
+	if err != nil {
+		return err
+	}
+
+	userID, ok := a.optionalUserID(req)
+	if !ok {
+		return nil
+	}
+	return a.setLikedByMe(req.Context(), userID, append(chirps, embedded...))
+}
+
 func (a *apiConfig) postChirpHandler(w http.ResponseWriter, req *http.Request) {
 	var chirpReq chirpRequest
 	decoder := json.NewDecoder(req.Body)
@@ -50,16 +96,10 @@ func (a *apiConfig) postChirpHandler(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	token, err := auth.GetBearerToken(req.Header)
-	if err != nil {
-		log.Printf("Error getting bearer token: %s", err)
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-	userID, err := auth.ValidateJWT(token, a.JWTSecret)
+	userID, err := a.authenticate(req, auth.ScopeChirpsWrite)
 	if err != nil {
-		log.Printf("Error validating JWT: %s", err)
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		log.Printf("Error authenticating request: %s", err)
+		respondAuthError(w, err)
 		return
 	}
 
@@ -70,9 +110,51 @@ func (a *apiConfig) postChirpHandler(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	chirp, err := a.dbQueries.CreateChirp(req.Context(), database.CreateChirpParams{
-		Body:   cleanedChirp.Body,
-		UserID: userID,
+	var parentID uuid.NullUUID
+	if chirpReq.InReplyTo != nil {
+		parent, err := a.dbQueries.GetChirpByID(req.Context(), *chirpReq.InReplyTo)
+		if err != nil {
+			log.Printf("Error getting chirp being replied to: %s", err)
+			http.Error(w, "Chirp being replied to not found", http.StatusBadRequest)
+			return
+		}
+		// Replies to a rechirp belong to the chirp it points at.
+		if parent.RechirpOfID.Valid {
+			parentID = parent.RechirpOfID
+		} else {
+			parentID = uuid.NullUUID{UUID: parent.ID, Valid: true}
+		}
+	}
+
+	var quoteOfID uuid.NullUUID
+	if chirpReq.QuoteOf != nil {
+		quoted, err := a.dbQueries.GetChirpByID(req.Context(), *chirpReq.QuoteOf)
+		if err != nil {
+			log.Printf("Error getting quoted chirp: %s", err)
+			http.Error(w, "Quoted chirp not found", http.StatusBadRequest)
+			return
+		}
+		if quoted.RechirpOfID.Valid {
+			quoteOfID = quoted.RechirpOfID
+		} else {
+			quoteOfID = uuid.NullUUID{UUID: quoted.ID, Valid: true}
+		}
+	}
+
+	tx, err := a.db.BeginTx(req.Context(), nil)
+	if err != nil {
+		log.Printf("Error starting transaction: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	qtx := a.dbQueries.WithTx(tx)
+
+	chirp, err := qtx.CreateChirp(req.Context(), database.CreateChirpParams{
+		Body:      cleanedChirp.Body,
+		UserID:    userID,
+		ParentID:  parentID,
+		QuoteOfID: quoteOfID,
 	})
 	if err != nil {
 		log.Printf("Error creating chirp: %s", err)
@@ -80,12 +162,34 @@ func (a *apiConfig) postChirpHandler(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	jsonChirp := Chirp{
-		ID:        chirp.ID,
-		Body:      chirp.Body,
-		CreatedAt: chirp.CreatedAt.Time,
-		UpdatedAt: chirp.UpdatedAt.Time,
-		UserID:    chirp.UserID,
+	err = saveChirpHashtags(req.Context(), qtx, chirp.ID, chirp.Body)
+	if err != nil {
+		log.Printf("Error saving chirp hashtags: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	err = saveChirpMentions(req.Context(), qtx, chirp.ID, chirp.Body)
+	if err != nil {
+		log.Printf("Error saving chirp mentions: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("Error committing chirp: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	jsonChirp := chirpFromDB(chirp)
+
+	err = a.prepareChirps(req, []*Chirp{&jsonChirp})
+	if err != nil {
+		log.Printf("Error preparing chirps: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -93,57 +197,193 @@ func (a *apiConfig) postChirpHandler(w http.ResponseWriter, req *http.Request) {
 	json.NewEncoder(w).Encode(jsonChirp)
 }
 
+// getChirpsHandler lists chirps oldest first unless sort=desc is given.
+// With author_id it lists one user's chirps, rechirps included, in the same
+// order as everything else, since rechirps are rows of their own dated when
+// they were shared.
 func (a *apiConfig) getChirpsHandler(w http.ResponseWriter, req *http.Request) {
-	userIDStr := req.URL.Query().Get("author_id")
-	sortOrder := req.URL.Query().Get("sort")
-	if sortOrder == "" {
-		sortOrder = "asc"
+	page, err := parsePageRequest(req.URL.Query(), false)
+	if err != nil {
+		log.Printf("Invalid pagination parameters: %s", err)
+		http.Error(w, "Invalid pagination parameters", http.StatusBadRequest)
+		return
 	}
-	var chirps []database.Chirp
-	var err error
-	if userIDStr == "" {
-		chirps, err = a.dbQueries.GetChirps(req.Context())
+
+	var authorID uuid.NullUUID
+	if userIDStr := req.URL.Query().Get("author_id"); userIDStr != "" {
+		userID, err := uuid.Parse(userIDStr)
 		if err != nil {
-			log.Printf("Error getting chirps: %s", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			log.Printf("Invalid user ID: %s", err)
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
 			return
 		}
+		authorID = uuid.NullUUID{UUID: userID, Valid: true}
+	}
+
+	// Fetch one extra row so we know whether another page follows.
+	var chirps []database.Chirp
+	if page.Desc {
+		chirps, err = a.dbQueries.ListChirpsDesc(req.Context(), database.ListChirpsDescParams{
+			AuthorID:        authorID,
+			AfterCreatedAt:  page.AfterCreatedAt,
+			AfterID:         page.AfterID,
+			BeforeCreatedAt: page.BeforeCreatedAt,
+			BeforeID:        page.BeforeID,
+			PageLimit:       page.Limit + 1,
+		})
 	} else {
-		userID, err := uuid.Parse(userIDStr)
+		chirps, err = a.dbQueries.ListChirpsAsc(req.Context(), database.ListChirpsAscParams{
+			AuthorID:        authorID,
+			AfterCreatedAt:  page.AfterCreatedAt,
+			AfterID:         page.AfterID,
+			BeforeCreatedAt: page.BeforeCreatedAt,
+			BeforeID:        page.BeforeID,
+			PageLimit:       page.Limit + 1,
+		})
+	}
+	if err != nil {
+		log.Printf("Error getting chirps: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	var nextCursor string
+	if len(chirps) > int(page.Limit) {
+		chirps = chirps[:page.Limit]
+		last := chirps[len(chirps)-1]
+		nextCursor = page.nextCursor(last.CreatedAt.Time, last.ID)
+	}
+
+	jsonChirps := make([]Chirp, len(chirps))
+	for i, chirp := range chirps {
+		jsonChirps[i] = chirpFromDB(chirp)
+	}
+
+	err = a.prepareChirps(req, chirpPointers(jsonChirps))
+	if err != nil {
+		log.Printf("Error preparing chirps: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(ChirpPage{
+		Chirps:     jsonChirps,
+		NextCursor: nextCursor,
+	})
+}
+
+// searchChirpsHandler runs a full-text search over chirp bodies. Results are
+// ordered by relevance, so unlike getChirpsHandler the only way to page is
+// forward, by passing next_cursor back as "cursor" ("after" is accepted too).
+// "before" and "sort" are rejected rather than silently ignored.
+func (a *apiConfig) searchChirpsHandler(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	searchQuery := strings.TrimSpace(query.Get("q"))
+	if searchQuery == "" {
+		http.Error(w, "Search query is required", http.StatusBadRequest)
+		return
+	}
+
+	if query.Has("before") || query.Has("sort") {
+		http.Error(w, "Search results are ordered by relevance and can only be paged forward", http.StatusBadRequest)
+		return
+	}
+
+	limit, err := parseLimit(query)
+	if err != nil {
+		log.Printf("Invalid pagination parameters: %s", err)
+		http.Error(w, "Invalid pagination parameters", http.StatusBadRequest)
+		return
+	}
+
+	after := query.Get("cursor")
+	if after == "" {
+		after = query.Get("after")
+	}
+
+	var afterRank sql.NullFloat64
+	var afterID uuid.NullUUID
+	if after != "" {
+		rank, id, err := decodeRankCursor(after)
 		if err != nil {
-			log.Printf("Invalid user ID: %s", err)
-			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			log.Printf("Invalid pagination parameters: %s", err)
+			http.Error(w, "Invalid pagination parameters", http.StatusBadRequest)
 			return
 		}
+		afterRank = sql.NullFloat64{Float64: float64(rank), Valid: true}
+		afterID = uuid.NullUUID{UUID: id, Valid: true}
+	}
 
-		chirps, err = a.dbQueries.GetChirpsByUserID(req.Context(), userID)
+	var authorID uuid.NullUUID
+	if userIDStr := query.Get("author_id"); userIDStr != "" {
+		userID, err := uuid.Parse(userIDStr)
 		if err != nil {
-			log.Printf("Error getting chirps by user ID: %s", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			log.Printf("Invalid user ID: %s", err)
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
 			return
 		}
+		authorID = uuid.NullUUID{UUID: userID, Valid: true}
 	}
 
-	jsonChirps := make([]Chirp, len(chirps))
-	for i, chirp := range chirps {
-		jsonChirps[i] = Chirp{
-			ID:        chirp.ID,
-			Body:      chirp.Body,
-			CreatedAt: chirp.CreatedAt.Time,
-			UpdatedAt: chirp.UpdatedAt.Time,
-			UserID:    chirp.UserID,
+	matches, err := a.dbQueries.SearchChirps(req.Context(), database.SearchChirpsParams{
+		Query:     searchQuery,
+		AuthorID:  authorID,
+		AfterRank: afterRank,
+		AfterID:   afterID,
+		PageLimit: limit + 1,
+	})
+	if err != nil {
+		log.Printf("Error searching chirps: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	var nextCursor string
+	if len(matches) > int(limit) {
+		matches = matches[:limit]
+		last := matches[len(matches)-1]
+		nextCursor = encodeRankCursor(last.Rank, last.ID)
+	}
+
+	ids := make([]uuid.UUID, len(matches))
+	for i, match := range matches {
+		ids[i] = match.ID
+	}
+
+	chirps, err := a.dbQueries.GetChirpsByIDs(req.Context(), ids)
+	if err != nil {
+		log.Printf("Error getting chirps by IDs: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	byID := make(map[uuid.UUID]database.Chirp, len(chirps))
+	for _, chirp := range chirps {
+		byID[chirp.ID] = chirp
+	}
+
+	jsonChirps := make([]Chirp, 0, len(matches))
+	for _, match := range matches {
+		if chirp, ok := byID[match.ID]; ok {
+			jsonChirps = append(jsonChirps, chirpFromDB(chirp))
 		}
 	}
 
-	if sortOrder == "desc" {
-		sort.Slice(jsonChirps, func(i, j int) bool {
-			return jsonChirps[i].CreatedAt.After(jsonChirps[j].CreatedAt)
-		})
+	err = a.prepareChirps(req, chirpPointers(jsonChirps))
+	if err != nil {
+		log.Printf("Error preparing chirps: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(jsonChirps)
+	json.NewEncoder(w).Encode(ChirpPage{
+		Chirps:     jsonChirps,
+		NextCursor: nextCursor,
+	})
 }
 
 func (a *apiConfig) getChirpByIDHandler(w http.ResponseWriter, req *http.Request) {
@@ -162,12 +402,13 @@ func (a *apiConfig) getChirpByIDHandler(w http.ResponseWriter, req *http.Request
 		return
 	}
 
-	jsonChirp := Chirp{
-		ID:        chirp.ID,
-		Body:      chirp.Body,
-		CreatedAt: chirp.CreatedAt.Time,
-		UpdatedAt: chirp.UpdatedAt.Time,
-		UserID:    chirp.UserID,
+	jsonChirp := chirpFromDB(chirp)
+
+	err = a.prepareChirps(req, []*Chirp{&jsonChirp})
+	if err != nil {
+		log.Printf("Error preparing chirps: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -175,7 +416,7 @@ func (a *apiConfig) getChirpByIDHandler(w http.ResponseWriter, req *http.Request
 	json.NewEncoder(w).Encode(jsonChirp)
 }
 
-func (a *apiConfig) deleteChirpHandler(w http.ResponseWriter, req *http.Request) {
+func (a *apiConfig) updateChirpHandler(w http.ResponseWriter, req *http.Request) {
 	chirpIDstr := req.PathValue("chirpID")
 	chirpID, err := uuid.Parse(chirpIDstr)
 	if err != nil {
@@ -184,17 +425,19 @@ func (a *apiConfig) deleteChirpHandler(w http.ResponseWriter, req *http.Request)
 		return
 	}
 
-	token, err := auth.GetBearerToken(req.Header)
+	userID, err := a.authenticate(req, auth.ScopeChirpsWrite)
 	if err != nil {
-		log.Printf("Error getting bearer token: %s", err)
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		log.Printf("Error authenticating request: %s", err)
+		respondAuthError(w, err)
 		return
 	}
 
-	userID, err := auth.ValidateJWT(token, a.JWTSecret)
+	var chirpReq chirpRequest
+	decoder := json.NewDecoder(req.Body)
+	err = decoder.Decode(&chirpReq)
 	if err != nil {
-		log.Printf("Error validating JWT: %s", err)
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		log.Printf("Error decoding chirp request: %s", err)
+		http.Error(w, "Invalid request", http.StatusBadRequest)
 		return
 	}
 
@@ -206,17 +449,286 @@ func (a *apiConfig) deleteChirpHandler(w http.ResponseWriter, req *http.Request)
 	}
 
 	if chirp.UserID != userID {
-		log.Printf("Unauthorized attempt to delete chirp by user %s", userID)
+		log.Printf("Unauthorized attempt to edit chirp by user %s", userID)
 		http.Error(w, "Forbidden", http.StatusForbidden)
 		return
 	}
 
-	err = a.dbQueries.DeleteChirpByID(req.Context(), chirpID)
+	if chirp.RechirpOfID.Valid {
+		http.Error(w, "Rechirps cannot be edited", http.StatusBadRequest)
+		return
+	}
+
+	cleanedChirp, errMsg := validateChirp(chirpReq.Body)
+	if errMsg.Message != "" {
+		log.Printf("Chirp validation error: %s", errMsg.Message)
+		http.Error(w, errMsg.Message, http.StatusBadRequest)
+		return
+	}
+
+	tx, err := a.db.BeginTx(req.Context(), nil)
+	if err != nil {
+		log.Printf("Error starting transaction: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	qtx := a.dbQueries.WithTx(tx)
+
+	// UpdateChirp copies the current body into chirp_revisions in the same
+	// statement, so the history can't drift from the live row.
+	chirp, err = qtx.UpdateChirp(req.Context(), database.UpdateChirpParams{
+		ID:     chirpID,
+		Body:   cleanedChirp.Body,
+		UserID: userID,
+	})
+	if err != nil {
+		log.Printf("Error updating chirp: %s", err)
+		http.Error(w, "Chirp not found", http.StatusNotFound)
+		return
+	}
+
+	err = saveChirpHashtags(req.Context(), qtx, chirp.ID, chirp.Body)
+	if err != nil {
+		log.Printf("Error saving chirp hashtags: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	err = saveChirpMentions(req.Context(), qtx, chirp.ID, chirp.Body)
+	if err != nil {
+		log.Printf("Error saving chirp mentions: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("Error committing chirp: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	jsonChirp := chirpFromDB(chirp)
+
+	err = a.prepareChirps(req, []*Chirp{&jsonChirp})
+	if err != nil {
+		log.Printf("Error preparing chirps: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(jsonChirp)
+}
+
+func (a *apiConfig) getChirpRevisionsHandler(w http.ResponseWriter, req *http.Request) {
+	chirpIDstr := req.PathValue("chirpID")
+	chirpID, err := uuid.Parse(chirpIDstr)
+	if err != nil {
+		log.Printf("Invalid chirp ID: %s", err)
+		http.Error(w, "Invalid chirp ID", http.StatusBadRequest)
+		return
+	}
+
+	_, err = a.dbQueries.GetChirpByID(req.Context(), chirpID)
+	if err != nil {
+		log.Printf("Error getting chirp by ID: %s", err)
+		http.Error(w, "Chirp not found", http.StatusNotFound)
+		return
+	}
+
+	revisions, err := a.dbQueries.GetChirpRevisions(req.Context(), chirpID)
+	if err != nil {
+		log.Printf("Error getting chirp revisions: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	jsonRevisions := make([]ChirpRevision, len(revisions))
+	for i, revision := range revisions {
+		jsonRevisions[i] = ChirpRevision{
+			ID:        revision.ID,
+			ChirpID:   revision.ChirpID,
+			Body:      revision.Body,
+			CreatedAt: revision.CreatedAt.Time,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(jsonRevisions)
+}
+
+func (a *apiConfig) getChirpThreadHandler(w http.ResponseWriter, req *http.Request) {
+	chirpIDstr := req.PathValue("chirpID")
+	chirpID, err := uuid.Parse(chirpIDstr)
+	if err != nil {
+		log.Printf("Invalid chirp ID: %s", err)
+		http.Error(w, "Invalid chirp ID", http.StatusBadRequest)
+		return
+	}
+
+	chirp, err := a.dbQueries.GetChirpByID(req.Context(), chirpID)
+	if err != nil {
+		log.Printf("Error getting chirp by ID: %s", err)
+		http.Error(w, "Chirp not found", http.StatusNotFound)
+		return
+	}
+
+	ancestors, err := a.dbQueries.GetChirpAncestors(req.Context(), chirpID)
+	if err != nil {
+		log.Printf("Error getting chirp ancestors: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	replies, err := a.dbQueries.GetChirpReplies(req.Context(), chirpID)
+	if err != nil {
+		log.Printf("Error getting chirp replies: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	thread := ChirpThread{
+		Ancestors: make([]Chirp, len(ancestors)),
+		Chirp:     &ThreadChirp{Chirp: chirpFromDB(chirp), Replies: []*ThreadChirp{}},
+	}
+	for i, ancestor := range ancestors {
+		thread.Ancestors[i] = chirpFromDB(ancestor)
+	}
+
+	// Replies come back oldest first, so every parent is already in the map
+	// by the time its children are attached.
+	nodes := map[uuid.UUID]*ThreadChirp{chirp.ID: thread.Chirp}
+	for _, reply := range replies {
+		node := &ThreadChirp{Chirp: chirpFromDB(reply), Replies: []*ThreadChirp{}}
+		nodes[reply.ID] = node
+		if parent, ok := nodes[reply.ParentID.UUID]; ok {
+			parent.Replies = append(parent.Replies, node)
+		}
+	}
+
+	threadChirps := chirpPointers(thread.Ancestors)
+	for _, node := range nodes {
+		threadChirps = append(threadChirps, &node.Chirp)
+	}
+	err = a.prepareChirps(req, threadChirps)
 	if err != nil {
-		log.Printf("Error deleting chirp: %s", err)
+		log.Printf("Error preparing chirps: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(thread)
+}
+
+func (a *apiConfig) deleteChirpHandler(w http.ResponseWriter, req *http.Request) {
+	chirpIDstr := req.PathValue("chirpID")
+	chirpID, err := uuid.Parse(chirpIDstr)
+	if err != nil {
+		log.Printf("Invalid chirp ID: %s", err)
+		http.Error(w, "Invalid chirp ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := a.authenticate(req, auth.ScopeChirpsWrite)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		respondAuthError(w, err)
+		return
+	}
+
+	// The chirp is locked for the rest of the transaction, which holds off
+	// new replies to it until the choice below has been carried out.
+	tx, err := a.db.BeginTx(req.Context(), nil)
+	if err != nil {
+		log.Printf("Error starting transaction: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+	qtx := a.dbQueries.WithTx(tx)
+
+	chirp, err := qtx.LockChirpByID(req.Context(), chirpID)
+	if err != nil {
+		log.Printf("Error getting chirp by ID: %s", err)
 		http.Error(w, "Chirp not found", http.StatusNotFound)
 		return
 	}
 
+	if chirp.UserID != userID {
+		log.Printf("Unauthorized attempt to delete chirp by user %s", userID)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	// A chirp with replies is replaced by a tombstone so the thread below it
+	// stays connected; anything else can simply be removed. reply_count
+	// leaves out hidden replies, which may come back, so the replies
+	// themselves are checked.
+	hasReplies, err := qtx.ChirpHasReplies(req.Context(), uuid.NullUUID{UUID: chirpID, Valid: true})
+	if err != nil {
+		log.Printf("Error checking for replies: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if hasReplies {
+		err = qtx.TombstoneChirpByID(req.Context(), chirpID)
+		if err != nil {
+			log.Printf("Error tombstoning chirp: %s", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		err = qtx.DeleteChirpRevisions(req.Context(), chirpID)
+		if err != nil {
+			log.Printf("Error deleting chirp revisions: %s", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		err = qtx.DeleteChirpHashtags(req.Context(), chirpID)
+		if err != nil {
+			log.Printf("Error deleting chirp hashtags: %s", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		err = qtx.DeleteChirpMentions(req.Context(), chirpID)
+		if err != nil {
+			log.Printf("Error deleting chirp mentions: %s", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		// Rechirps of a hard-deleted chirp go with it through ON DELETE
+		// CASCADE; a tombstone has nothing left to share, so drop them too.
+		err = qtx.DeleteRechirpsOf(req.Context(), chirpID)
+		if err != nil {
+			log.Printf("Error deleting rechirps: %s", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	} else {
+		err = qtx.DeleteChirpByID(req.Context(), chirpID)
+		if err != nil {
+			log.Printf("Error deleting chirp: %s", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("Error committing chirp deletion: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
 	w.WriteHeader(http.StatusNoContent)
 }
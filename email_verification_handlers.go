@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/TheJa750/Chirpy/internal/auth"
+	"github.com/TheJa750/Chirpy/internal/database"
+	"github.com/TheJa750/Chirpy/internal/mailer"
+	"github.com/google/uuid"
+)
+
+const emailVerificationTTL = 24 * time.Hour
+
+var errEmailNotVerified = errors.New("email address is not verified")
+
+// isWriteScope reports whether a scope lets the caller change data.
+func isWriteScope(scope string) bool {
+	return strings.HasSuffix(scope, ":write")
+}
+
+// sendVerificationEmail mails a link that confirms the user can receive mail
+// at email, which is either their current address or a pending new one.
+func (a *apiConfig) sendVerificationEmail(ctx context.Context, userID uuid.UUID, email string) error {
+	token, err := auth.MakeEmailVerificationToken(userID, email, a.JWT, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	link := a.BaseURL + "/api/verify-email?token=" + url.QueryEscape(token)
+	return a.Mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Confirm your email address for Chirpy",
+		Body: fmt.Sprintf("Please confirm this is your email address by opening the link below within 24 hours:\n\n"+
+			"%s\n\nIf you didn't ask for this, you can ignore this email.\n", link),
+	})
+}
+
+func (a *apiConfig) verifyEmailHandler(w http.ResponseWriter, req *http.Request) {
+	userID, email, err := auth.ValidateEmailVerificationToken(req.URL.Query().Get("token"), a.JWT)
+	if errors.Is(err, auth.ErrExpired) {
+		http.Error(w, "This verification link has expired, please request a new one", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Error validating email verification token: %s", err)
+		http.Error(w, "Invalid verification link", http.StatusBadRequest)
+		return
+	}
+
+	// The link only works while the address in it is still the account's
+	// email or its pending change; links for abandoned changes are dead.
+	_, err = a.dbQueries.ConfirmEmail(req.Context(), database.ConfirmEmailParams{
+		ID:    userID,
+		Email: email,
+	})
+	if isUniqueViolation(err, "users_email_key") {
+		http.Error(w, "This email address is already used by another account", http.StatusConflict)
+		return
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "This verification link is no longer valid", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Error confirming email: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Your email address has been verified.\n"))
+}
+
+func (a *apiConfig) resendVerificationHandler(w http.ResponseWriter, req *http.Request) {
+	user, err := a.authenticateSession(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		respondAuthError(w, err)
+		return
+	}
+
+	email := user.Email
+	if user.PendingEmail.Valid {
+		email = user.PendingEmail.String
+	} else if user.EmailVerifiedAt.Valid {
+		http.Error(w, "Email address is already verified", http.StatusConflict)
+		return
+	}
+
+	err = a.sendVerificationEmail(req.Context(), user.ID, email)
+	if err != nil {
+		log.Printf("Error sending verification email: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/TheJa750/Chirpy/internal/auth"
+	"github.com/TheJa750/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func (a *apiConfig) followUserHandler(w http.ResponseWriter, req *http.Request) {
+	followeeIDstr := req.PathValue("userID")
+	followeeID, err := uuid.Parse(followeeIDstr)
+	if err != nil {
+		log.Printf("Invalid user ID: %s", err)
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := a.authenticate(req, auth.ScopeFollowsWrite)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		respondAuthError(w, err)
+		return
+	}
+
+	if followeeID == userID {
+		http.Error(w, "You cannot follow yourself", http.StatusBadRequest)
+		return
+	}
+
+	_, err = a.dbQueries.GetUserByID(req.Context(), followeeID)
+	if err != nil {
+		log.Printf("Error getting user by ID: %s", err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	err = a.dbQueries.FollowUser(req.Context(), database.FollowUserParams{
+		FollowerID: userID,
+		FolloweeID: followeeID,
+	})
+	if err != nil {
+		log.Printf("Error following user: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *apiConfig) unfollowUserHandler(w http.ResponseWriter, req *http.Request) {
+	followeeIDstr := req.PathValue("userID")
+	followeeID, err := uuid.Parse(followeeIDstr)
+	if err != nil {
+		log.Printf("Invalid user ID: %s", err)
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := a.authenticate(req, auth.ScopeFollowsWrite)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		respondAuthError(w, err)
+		return
+	}
+
+	err = a.dbQueries.UnfollowUser(req.Context(), database.UnfollowUserParams{
+		FollowerID: userID,
+		FolloweeID: followeeID,
+	})
+	if err != nil {
+		log.Printf("Error unfollowing user: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getFollowersHandler lists who follows a user, newest follow first.
+func (a *apiConfig) getFollowersHandler(w http.ResponseWriter, req *http.Request) {
+	userIDstr := req.PathValue("userID")
+	userID, err := uuid.Parse(userIDstr)
+	if err != nil {
+		log.Printf("Invalid user ID: %s", err)
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	page, err := parseNewestFirstPage(req.URL.Query())
+	if err != nil {
+		log.Printf("Invalid pagination parameters: %s", err)
+		http.Error(w, "Invalid pagination parameters", http.StatusBadRequest)
+		return
+	}
+
+	follows, err := a.dbQueries.ListFollowers(req.Context(), database.ListFollowersParams{
+		UserID:          userID,
+		AfterCreatedAt:  page.AfterCreatedAt,
+		AfterID:         page.AfterID,
+		BeforeCreatedAt: page.BeforeCreatedAt,
+		BeforeID:        page.BeforeID,
+		PageLimit:       page.Limit + 1,
+	})
+	if err != nil {
+		log.Printf("Error getting followers: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	var nextCursor string
+	if len(follows) > int(page.Limit) {
+		follows = follows[:page.Limit]
+		last := follows[len(follows)-1]
+		nextCursor = page.nextCursor(last.CreatedAt.Time, last.FollowerID)
+	}
+
+	jsonFollows := make([]Follow, len(follows))
+	for i, follow := range follows {
+		jsonFollows[i] = Follow{
+			UserID:     follow.FollowerID,
+			FollowedAt: follow.CreatedAt.Time,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(FollowPage{
+		Users:      jsonFollows,
+		NextCursor: nextCursor,
+	})
+}
+
+// getFollowingHandler lists who a user follows, newest follow first.
+func (a *apiConfig) getFollowingHandler(w http.ResponseWriter, req *http.Request) {
+	userIDstr := req.PathValue("userID")
+	userID, err := uuid.Parse(userIDstr)
+	if err != nil {
+		log.Printf("Invalid user ID: %s", err)
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	page, err := parseNewestFirstPage(req.URL.Query())
+	if err != nil {
+		log.Printf("Invalid pagination parameters: %s", err)
+		http.Error(w, "Invalid pagination parameters", http.StatusBadRequest)
+		return
+	}
+
+	follows, err := a.dbQueries.ListFollowing(req.Context(), database.ListFollowingParams{
+		UserID:          userID,
+		AfterCreatedAt:  page.AfterCreatedAt,
+		AfterID:         page.AfterID,
+		BeforeCreatedAt: page.BeforeCreatedAt,
+		BeforeID:        page.BeforeID,
+		PageLimit:       page.Limit + 1,
+	})
+	if err != nil {
+		log.Printf("Error getting followed users: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	var nextCursor string
+	if len(follows) > int(page.Limit) {
+		follows = follows[:page.Limit]
+		last := follows[len(follows)-1]
+		nextCursor = page.nextCursor(last.CreatedAt.Time, last.FolloweeID)
+	}
+
+	jsonFollows := make([]Follow, len(follows))
+	for i, follow := range follows {
+		jsonFollows[i] = Follow{
+			UserID:     follow.FolloweeID,
+			FollowedAt: follow.CreatedAt.Time,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(FollowPage{
+		Users:      jsonFollows,
+		NextCursor: nextCursor,
+	})
+}
+
+// getTimelineHandler returns the caller's home timeline: their own chirps plus
+// those of everyone they follow, newest first unless sort=asc is given.
+func (a *apiConfig) getTimelineHandler(w http.ResponseWriter, req *http.Request) {
+	userID, err := a.authenticate(req, auth.ScopeChirpsRead)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		respondAuthError(w, err)
+		return
+	}
+
+	page, err := parsePageRequest(req.URL.Query(), true)
+	if err != nil {
+		log.Printf("Invalid pagination parameters: %s", err)
+		http.Error(w, "Invalid pagination parameters", http.StatusBadRequest)
+		return
+	}
+
+	var chirps []database.Chirp
+	if page.Desc {
+		chirps, err = a.dbQueries.ListTimelineDesc(req.Context(), database.ListTimelineDescParams{
+			UserID:          userID,
+			AfterCreatedAt:  page.AfterCreatedAt,
+			AfterID:         page.AfterID,
+			BeforeCreatedAt: page.BeforeCreatedAt,
+			BeforeID:        page.BeforeID,
+			PageLimit:       page.Limit + 1,
+		})
+	} else {
+		chirps, err = a.dbQueries.ListTimelineAsc(req.Context(), database.ListTimelineAscParams{
+			UserID:          userID,
+			AfterCreatedAt:  page.AfterCreatedAt,
+			AfterID:         page.AfterID,
+			BeforeCreatedAt: page.BeforeCreatedAt,
+			BeforeID:        page.BeforeID,
+			PageLimit:       page.Limit + 1,
+		})
+	}
+	if err != nil {
+		log.Printf("Error getting timeline: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	var nextCursor string
+	if len(chirps) > int(page.Limit) {
+		chirps = chirps[:page.Limit]
+		last := chirps[len(chirps)-1]
+		nextCursor = page.nextCursor(last.CreatedAt.Time, last.ID)
+	}
+
+	jsonChirps := make([]Chirp, len(chirps))
+	for i, chirp := range chirps {
+		jsonChirps[i] = chirpFromDB(chirp)
+	}
+
+	err = a.prepareChirps(req, chirpPointers(jsonChirps))
+	if err != nil {
+		log.Printf("Error preparing chirps: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(ChirpPage{
+		Chirps:     jsonChirps,
+		NextCursor: nextCursor,
+	})
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/TheJa750/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	trendingWindow   = 24 * time.Hour
+	trendingHalfLife = 6 * time.Hour
+)
+
+var hashtagPattern = regexp.MustCompile(`(?:^|\s)#([\p{L}\p{N}_]+)`)
+
+// extractHashtags returns the distinct, lower-cased tags in a chirp body.
+func extractHashtags(body string) []string {
+	seen := map[string]bool{}
+	tags := []string{}
+	for _, match := range hashtagPattern.FindAllStringSubmatch(body, -1) {
+		tag := strings.ToLower(match[1])
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// saveChirpHashtags replaces the hashtags stored for a chirp with the ones
+// found in its body. They are dated with the chirp's creation time, so
+// editing an old chirp doesn't send its hashtags back up the trending list.
+// Like saveChirpMentions, it runs on the caller's queries.
+func saveChirpHashtags(ctx context.Context, q *database.Queries, chirpID uuid.UUID, body string) error {
+	err := q.DeleteChirpHashtags(ctx, chirpID)
+	if err != nil {
+		return err
+	}
+
+	tags := extractHashtags(body)
+	if len(tags) == 0 {
+		return nil
+	}
+
+	return q.CreateChirpHashtags(ctx, database.CreateChirpHashtagsParams{
+		ChirpID: chirpID,
+		Tags:    tags,
+	})
+}
+
+// getHashtagChirpsHandler lists the chirps tagged with a hashtag, newest first
+// unless sort=asc is given.
+func (a *apiConfig) getHashtagChirpsHandler(w http.ResponseWriter, req *http.Request) {
+	tag := strings.ToLower(strings.TrimPrefix(req.PathValue("tag"), "#"))
+	if tag == "" {
+		http.Error(w, "Invalid hashtag", http.StatusBadRequest)
+		return
+	}
+
+	page, err := parsePageRequest(req.URL.Query(), true)
+	if err != nil {
+		log.Printf("Invalid pagination parameters: %s", err)
+		http.Error(w, "Invalid pagination parameters", http.StatusBadRequest)
+		return
+	}
+
+	var chirps []database.Chirp
+	if page.Desc {
+		chirps, err = a.dbQueries.ListHashtagChirpsDesc(req.Context(), database.ListHashtagChirpsDescParams{
+			Tag:             tag,
+			AfterCreatedAt:  page.AfterCreatedAt,
+			AfterID:         page.AfterID,
+			BeforeCreatedAt: page.BeforeCreatedAt,
+			BeforeID:        page.BeforeID,
+			PageLimit:       page.Limit + 1,
+		})
+	} else {
+		chirps, err = a.dbQueries.ListHashtagChirpsAsc(req.Context(), database.ListHashtagChirpsAscParams{
+			Tag:             tag,
+			AfterCreatedAt:  page.AfterCreatedAt,
+			AfterID:         page.AfterID,
+			BeforeCreatedAt: page.BeforeCreatedAt,
+			BeforeID:        page.BeforeID,
+			PageLimit:       page.Limit + 1,
+		})
+	}
+	if err != nil {
+		log.Printf("Error getting hashtag chirps: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	var nextCursor string
+	if len(chirps) > int(page.Limit) {
+		chirps = chirps[:page.Limit]
+		last := chirps[len(chirps)-1]
+		nextCursor = page.nextCursor(last.CreatedAt.Time, last.ID)
+	}
+
+	jsonChirps := make([]Chirp, len(chirps))
+	for i, chirp := range chirps {
+		jsonChirps[i] = chirpFromDB(chirp)
+	}
+
+	err = a.prepareChirps(req, chirpPointers(jsonChirps))
+	if err != nil {
+		log.Printf("Error preparing chirps: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(ChirpPage{
+		Chirps:     jsonChirps,
+		NextCursor: nextCursor,
+	})
+}
+
+// getTrendingHashtagsHandler ranks the tags used within trendingWindow. Each
+// use counts for less the older it is, halving every trendingHalfLife, so a
+// burst of recent activity outranks steady use earlier in the day.
+func (a *apiConfig) getTrendingHashtagsHandler(w http.ResponseWriter, req *http.Request) {
+	limit, err := parseLimit(req.URL.Query())
+	if err != nil {
+		log.Printf("Invalid pagination parameters: %s", err)
+		http.Error(w, "Invalid pagination parameters", http.StatusBadRequest)
+		return
+	}
+
+	trending, err := a.dbQueries.GetTrendingHashtags(req.Context(), database.GetTrendingHashtagsParams{
+		HalfLifeSeconds: trendingHalfLife.Seconds(),
+		WindowSeconds:   trendingWindow.Seconds(),
+		PageLimit:       limit,
+	})
+	if err != nil {
+		log.Printf("Error getting trending hashtags: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	jsonHashtags := make([]TrendingHashtag, len(trending))
+	for i, hashtag := range trending {
+		jsonHashtags[i] = TrendingHashtag{
+			Tag:   hashtag.Tag,
+			Score: hashtag.Score,
+			Uses:  hashtag.Uses,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(jsonHashtags)
+}
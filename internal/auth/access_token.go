@@ -2,38 +2,176 @@ package auth
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
-func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	claims := jwt.RegisteredClaims{
-		Issuer:    "chirpy",
-		IssuedAt:  jwt.NewNumericDate(time.Now()),
-		Subject:   userID.String(),
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
+var (
+	ErrMalformedToken   = errors.New("token is malformed")
+	ErrExpired          = errors.New("token has expired")
+	ErrNotYetValid      = errors.New("token is not valid yet")
+	ErrInvalidSignature = errors.New("token signature is invalid")
+	ErrInvalidAlgorithm = errors.New("token signing algorithm is not allowed")
+	ErrUnknownKey       = errors.New("token was signed by an unknown key")
+	ErrInvalidIssuer    = errors.New("token issuer is invalid")
+	ErrInvalidAudience  = errors.New("token audience is invalid")
+	ErrDelegatedToken   = errors.New("token was issued to a third-party client")
+)
+
+// JWTConfig describes the access tokens this service issues and accepts.
+// Leeway is the clock skew tolerated when checking exp, nbf and iat.
+type JWTConfig struct {
+	Keys     *Keyring
+	Issuer   string
+	Audience string
+	Leeway   time.Duration
+}
+
+// Claims are the claims carried by access tokens. Tokens issued to an OAuth
+// client name the client and the scopes the user granted it; tokens from a
+// login have neither and carry the user's full authority.
+type Claims struct {
+	jwt.RegisteredClaims
+	ClientID string `json:"client_id,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+}
+
+// Delegated reports whether the token was issued to a third-party client.
+func (c *Claims) Delegated() bool {
+	return c.ClientID != ""
+}
+
+// Scopes returns the scopes granted to a delegated token.
+func (c *Claims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+func (c *Claims) UserID() (uuid.UUID, error) {
+	userID, err := uuid.Parse(c.Subject)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("%w: invalid subject", ErrMalformedToken)
 	}
+	return userID, nil
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(tokenSecret))
+func MakeJWT(userID uuid.UUID, config JWTConfig, expiresIn time.Duration) (string, error) {
+	return signJWT(newClaims(userID, config, expiresIn), config)
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(tokenSecret), nil
-	})
+// MakeDelegatedJWT issues an access token that lets an OAuth client act for
+// the user within the given scopes.
+func MakeDelegatedJWT(userID uuid.UUID, clientID string, scopes []string, config JWTConfig, expiresIn time.Duration) (string, error) {
+	claims := newClaims(userID, config, expiresIn)
+	claims.ClientID = clientID
+	claims.Scope = strings.Join(scopes, " ")
+	return signJWT(claims, config)
+}
+
+func newClaims(userID uuid.UUID, config JWTConfig, expiresIn time.Duration) *Claims {
+	return &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    config.Issuer,
+			Audience:  jwt.ClaimStrings{config.Audience},
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Subject:   userID.String(),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
+		},
+	}
+}
 
+func signJWT(claims jwt.Claims, config JWTConfig) (string, error) {
+	active := config.Keys.active
+	token := jwt.NewWithClaims(active.Method, claims)
+	token.Header["kid"] = active.ID
+	return token.SignedString(active.private)
+}
+
+// ParseJWT checks an access token against the config and returns its claims.
+// Failures wrap one of the Err* values above so callers can tell the client
+// what went wrong.
+func ParseJWT(tokenString string, config JWTConfig) (*Claims, error) {
+	claims := &Claims{}
+	err := parseSignedToken(tokenString, claims, config, config.Audience)
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// parseSignedToken verifies any token signed with the keyring. Each kind of
+// token has its own audience, so one can never be passed off as another.
+func parseSignedToken(tokenString string, claims jwt.Claims, config JWTConfig, audience string) error {
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := config.Keys.Lookup(kid)
+		if !ok {
+			return nil, ErrUnknownKey
+		}
+		// The algorithm is pinned to the key, never taken from the token, so
+		// a key can't be used with a weaker or different algorithm.
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, ErrInvalidAlgorithm
+		}
+		return key.public, nil
+	},
+		jwt.WithIssuer(config.Issuer),
+		jwt.WithAudience(audience),
+		jwt.WithLeeway(config.Leeway),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
 	if err != nil {
-		return uuid.Nil, err
+		return classifyJWTError(err)
 	}
+	if !token.Valid {
+		return ErrMalformedToken
+	}
+	return nil
+}
+
+// ValidateJWT checks an access token and returns the user it was issued to,
+// along with the scopes granted to the OAuth client holding it. Scopes are
+// nil for a token from a login, which carries the user's full authority, and
+// never nil for a delegated token, so callers can tell the two apart.
+func ValidateJWT(tokenString string, config JWTConfig) (uuid.UUID, []string, error) {
+	claims, err := ParseJWT(tokenString, config)
+	if err != nil {
+		return uuid.Nil, nil, err
+	}
+	userID, err := claims.UserID()
+	if err != nil {
+		return uuid.Nil, nil, err
+	}
+	if !claims.Delegated() {
+		return userID, nil, nil
+	}
+	return userID, append([]string{}, claims.Scopes()...), nil
+}
 
-	if claims, ok := token.Claims.(*jwt.RegisteredClaims); ok && token.Valid {
-		return uuid.Parse(claims.Subject)
+func classifyJWTError(err error) error {
+	switch {
+	case errors.Is(err, ErrUnknownKey):
+		return ErrUnknownKey
+	case errors.Is(err, ErrInvalidAlgorithm):
+		return ErrInvalidAlgorithm
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid):
+		return ErrInvalidSignature
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return ErrExpired
+	case errors.Is(err, jwt.ErrTokenNotValidYet), errors.Is(err, jwt.ErrTokenUsedBeforeIssued):
+		return ErrNotYetValid
+	case errors.Is(err, jwt.ErrTokenInvalidIssuer):
+		return ErrInvalidIssuer
+	case errors.Is(err, jwt.ErrTokenInvalidAudience):
+		return ErrInvalidAudience
+	default:
+		return fmt.Errorf("%w: %v", ErrMalformedToken, err)
 	}
-	return uuid.Nil, errors.New("invalid token")
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
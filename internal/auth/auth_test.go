@@ -1,10 +1,17 @@
 package auth
 
 import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
@@ -41,26 +48,343 @@ func TestCheckPasswordHash(t *testing.T) {
 	}
 }
 
+func TestArgon2idHasher(t *testing.T) {
+	hasher := Argon2idHasher{Params: Argon2Params{Memory: 8 * 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}}
+
+	hash, err := hasher.Hash("testPassword")
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=8192,t=1,p=1$") {
+		t.Fatalf("Expected a PHC argon2id hash, got %q", hash)
+	}
+
+	if err := hasher.Verify(hash, "testPassword"); err != nil {
+		t.Fatalf("Password check failed: %v", err)
+	}
+	if err := hasher.Verify(hash, "wrongPassword"); !errors.Is(err, ErrPasswordMismatch) {
+		t.Fatalf("Expected ErrPasswordMismatch, got %v", err)
+	}
+	if hasher.NeedsRehash(hash) {
+		t.Fatal("Hash made with the current parameters should not need a rehash")
+	}
+
+	stronger := Argon2idHasher{Params: hasher.Params}
+	stronger.Params.Iterations = 2
+	if !stronger.NeedsRehash(hash) {
+		t.Fatal("Hash made with weaker parameters should need a rehash")
+	}
+	if err := stronger.Verify(hash, "testPassword"); err != nil {
+		t.Fatalf("Hash made with other parameters should still verify: %v", err)
+	}
+
+	if err := hasher.Verify("$argon2id$v=19$m=8192,t=1,p=1$bad", "testPassword"); err == nil {
+		t.Fatal("Expected malformed hash to be rejected")
+	}
+
+	salt, key, _ := strings.Cut(strings.TrimPrefix(hash, "$argon2id$v=19$m=8192,t=1,p=1$"), "$")
+	for _, params := range []string{"m=4194304,t=1,p=1", "m=8192,t=1000,p=1", "m=8192,t=1,p=64"} {
+		oversized := "$argon2id$v=19$" + params + "$" + salt + "$" + key
+		if err := hasher.Verify(oversized, "testPassword"); !errors.Is(err, ErrMalformedArgonHash) {
+			t.Fatalf("Expected hash with %s to be rejected, got %v", params, err)
+		}
+	}
+}
+
+func TestLegacyBcryptHash(t *testing.T) {
+	hash, err := BcryptHasher{Cost: 4}.Hash("testPassword")
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+
+	err = CheckPasswordHash(hash, "testPassword")
+	if err != nil {
+		t.Fatalf("bcrypt hash should still verify: %v", err)
+	}
+	if err := CheckPasswordHash(hash, "wrongPassword"); !errors.Is(err, ErrPasswordMismatch) {
+		t.Fatalf("Expected ErrPasswordMismatch, got %v", err)
+	}
+	if !defaultHasher.NeedsRehash(hash) {
+		t.Fatal("bcrypt hash should need a rehash")
+	}
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	policy, err := NewPasswordPolicy(8, 16, strings.NewReader("# site specific\ncorrecthorse\n"))
+	if err != nil {
+		t.Fatalf("Failed to create password policy: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		want     []string
+	}{
+		{"acceptable", "tr0ub4dor&3x", nil},
+		{"too short", "k9$z", []string{PasswordTooShort}},
+		{"too long", "this passphrase is far too long", []string{PasswordTooLong}},
+		{"counts characters not bytes", "ééééééé", []string{PasswordTooShort}},
+		{"bundled list", "Password123", []string{PasswordCommon}},
+		{"short and common", "qwerty", []string{PasswordTooShort, PasswordCommon}},
+		{"extra blocklist", "CorrectHorse", []string{PasswordCommon}},
+	}
+
+	for _, tt := range tests {
+		var got []string
+		for _, v := range policy.Validate(tt.password) {
+			got = append(got, v.Code)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: expected violations %v, got %v", tt.name, tt.want, got)
+		}
+	}
+
+	_, err = NewPasswordPolicy(12, 8)
+	if err == nil {
+		t.Error("Expected a maximum below the minimum to be rejected")
+	}
+}
+
+func TestLoginThrottleDelay(t *testing.T) {
+	throttle := LoginThrottle{
+		FreeAttempts:    3,
+		BaseDelay:       time.Second,
+		MaxDelay:        10 * time.Second,
+		LockoutAfter:    10,
+		LockoutDuration: 15 * time.Minute,
+		Window:          time.Hour,
+	}
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, 0},
+		{3, 0},
+		{4, time.Second},
+		{5, 2 * time.Second},
+		{6, 4 * time.Second},
+		{7, 8 * time.Second},
+		{8, 10 * time.Second},
+		{9, 10 * time.Second},
+		{10, 15 * time.Minute},
+		{25, 15 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		got := throttle.Delay(tt.failures)
+		if got != tt.want {
+			t.Errorf("Delay(%d): expected %s, got %s", tt.failures, tt.want, got)
+		}
+	}
+
+	schedule := throttle.Schedule()
+	want := []int32{0, 0, 0, 1, 2, 4, 8, 10, 10, 900}
+	if fmt.Sprint(schedule) != fmt.Sprint(want) {
+		t.Errorf("Expected schedule %v, got %v", want, schedule)
+	}
+
+	throttle.LockoutAfter = 0
+	if got := throttle.Delay(50); got != 10*time.Second {
+		t.Errorf("Without lockout expected the maximum delay, got %s", got)
+	}
+
+	schedule = throttle.Schedule()
+	want = []int32{0, 0, 0, 1, 2, 4, 8, 10}
+	if fmt.Sprint(schedule) != fmt.Sprint(want) {
+		t.Errorf("Without lockout expected schedule %v, got %v", want, schedule)
+	}
+}
+
+func testJWTConfig(t *testing.T, alg string) JWTConfig {
+	t.Helper()
+	key, err := GenerateSigningKey(alg)
+	if err != nil {
+		t.Fatalf("Failed to generate signing key: %v", err)
+	}
+	keyring, err := NewKeyring(key)
+	if err != nil {
+		t.Fatalf("Failed to create keyring: %v", err)
+	}
+	return JWTConfig{
+		Keys:     keyring,
+		Issuer:   "chirpy",
+		Audience: "chirpy",
+		Leeway:   30 * time.Second,
+	}
+}
+
 func TestJWT(t *testing.T) {
-	userID, _ := uuid.Parse("123e4567-e89b-12d3-a456-426614174000")
-	token, err := MakeJWT(userID, "testSecret", 3600*time.Second)
+	for _, alg := range []string{AlgEdDSA, AlgRS256} {
+		config := testJWTConfig(t, alg)
+		userID, _ := uuid.Parse("123e4567-e89b-12d3-a456-426614174000")
+		token, err := MakeJWT(userID, config, 3600*time.Second)
+		if err != nil {
+			t.Fatalf("Failed to create %s JWT: %v", alg, err)
+		}
+		if token == "" {
+			t.Fatal("JWT should not be empty")
+		}
+
+		parsedID, _, err := ValidateJWT(token, config)
+		if err != nil {
+			t.Fatalf("Failed to validate %s JWT: %v", alg, err)
+		}
+		if parsedID != userID {
+			t.Fatalf("Expected user ID %s, got %s", userID, parsedID)
+		}
+		_, _, err = ValidateJWT("invalidToken", config)
+		if err == nil {
+			t.Fatal("Expected validation to fail with invalid token")
+		}
+		_, _, err = ValidateJWT(token, testJWTConfig(t, alg))
+		if err == nil {
+			t.Fatal("Expected validation to fail with a different keyring")
+		}
+	}
+}
+
+func TestKeyringRotation(t *testing.T) {
+	oldKey, err := GenerateSigningKey(AlgEdDSA)
+	if err != nil {
+		t.Fatalf("Failed to generate signing key: %v", err)
+	}
+	oldKeyring, err := NewKeyring(oldKey)
+	if err != nil {
+		t.Fatalf("Failed to create keyring: %v", err)
+	}
+
+	userID := uuid.New()
+	config := testJWTConfig(t, AlgEdDSA)
+	config.Keys = oldKeyring
+	token, err := MakeJWT(userID, config, time.Hour)
 	if err != nil {
 		t.Fatalf("Failed to create JWT: %v", err)
 	}
-	if token == "" {
-		t.Fatal("JWT should not be empty")
+
+	// Retired keys are usually configured from their public half only.
+	der, err := x509.MarshalPKIXPublicKey(oldKey.public)
+	if err != nil {
+		t.Fatalf("Failed to marshal public key: %v", err)
+	}
+	publicOnly, err := ParseSigningKeyPEM(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	if err != nil {
+		t.Fatalf("Failed to parse public key: %v", err)
+	}
+	if publicOnly.ID != oldKey.ID {
+		t.Fatalf("Expected public key ID %s, got %s", oldKey.ID, publicOnly.ID)
+	}
+
+	newKey, err := GenerateSigningKey(AlgRS256)
+	if err != nil {
+		t.Fatalf("Failed to generate signing key: %v", err)
+	}
+	rotated, err := NewKeyring(newKey, publicOnly)
+	if err != nil {
+		t.Fatalf("Failed to create keyring: %v", err)
 	}
 
-	parsedID, err := ValidateJWT(token, "testSecret")
+	config.Keys = rotated
+	parsedID, _, err := ValidateJWT(token, config)
 	if err != nil {
-		t.Fatalf("Failed to validate JWT: %v", err)
+		t.Fatalf("Token signed by a retired key should still validate: %v", err)
 	}
 	if parsedID != userID {
 		t.Fatalf("Expected user ID %s, got %s", userID, parsedID)
 	}
-	_, err = ValidateJWT("invalidToken", "testSecret")
-	if err == nil {
-		t.Fatal("Expected validation to fail with invalid token")
+
+	jwks := rotated.JWKS()
+	if len(jwks.Keys) != 2 || jwks.Keys[0].Kid != newKey.ID || jwks.Keys[1].Kid != oldKey.ID {
+		t.Fatalf("Expected JWKS with the active key first, got %+v", jwks.Keys)
+	}
+
+	if _, err := NewKeyring(publicOnly); err == nil {
+		t.Fatal("Expected a public-only key to be rejected as the active key")
+	}
+}
+
+func TestValidateJWTErrors(t *testing.T) {
+	config := testJWTConfig(t, AlgEdDSA)
+	userID := uuid.New()
+
+	sign := func(claims jwt.RegisteredClaims) string {
+		token := jwt.NewWithClaims(config.Keys.active.Method, claims)
+		token.Header["kid"] = config.Keys.active.ID
+		signed, err := token.SignedString(config.Keys.active.private)
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v", err)
+		}
+		return signed
+	}
+	claims := func(issuedAt, expiresAt time.Time) jwt.RegisteredClaims {
+		return jwt.RegisteredClaims{
+			Issuer:    config.Issuer,
+			Audience:  jwt.ClaimStrings{config.Audience},
+			Subject:   userID.String(),
+			IssuedAt:  jwt.NewNumericDate(issuedAt),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		}
+	}
+
+	now := time.Now()
+
+	_, _, err := ValidateJWT(sign(claims(now.Add(-time.Hour), now.Add(-10*time.Second))), config)
+	if err != nil {
+		t.Fatalf("Expected a token expired within the leeway to validate: %v", err)
+	}
+
+	_, _, err = ValidateJWT(sign(claims(now.Add(-time.Hour), now.Add(-time.Minute))), config)
+	if !errors.Is(err, ErrExpired) {
+		t.Fatalf("Expected ErrExpired, got %v", err)
+	}
+
+	_, _, err = ValidateJWT(sign(claims(now.Add(time.Hour), now.Add(2*time.Hour))), config)
+	if !errors.Is(err, ErrNotYetValid) {
+		t.Fatalf("Expected ErrNotYetValid, got %v", err)
+	}
+
+	wrongIssuer := claims(now, now.Add(time.Hour))
+	wrongIssuer.Issuer = "someone-else"
+	_, _, err = ValidateJWT(sign(wrongIssuer), config)
+	if !errors.Is(err, ErrInvalidIssuer) {
+		t.Fatalf("Expected ErrInvalidIssuer, got %v", err)
+	}
+
+	wrongAudience := claims(now, now.Add(time.Hour))
+	wrongAudience.Audience = jwt.ClaimStrings{"another-service"}
+	_, _, err = ValidateJWT(sign(wrongAudience), config)
+	if !errors.Is(err, ErrInvalidAudience) {
+		t.Fatalf("Expected ErrInvalidAudience, got %v", err)
+	}
+
+	valid := sign(claims(now, now.Add(time.Hour)))
+	tampered := valid[:len(valid)-4] + "AAAA"
+	_, _, err = ValidateJWT(tampered, config)
+	if !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("Expected ErrInvalidSignature, got %v", err)
+	}
+
+	// A token claiming HS256 must not be verified with the key's public half
+	// as an HMAC secret.
+	hmacToken := jwt.NewWithClaims(jwt.SigningMethodHS256, claims(now, now.Add(time.Hour)))
+	hmacToken.Header["kid"] = config.Keys.active.ID
+	hmacSigned, err := hmacToken.SignedString([]byte(config.Keys.active.public.(ed25519.PublicKey)))
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	_, _, err = ValidateJWT(hmacSigned, config)
+	if !errors.Is(err, ErrInvalidAlgorithm) {
+		t.Fatalf("Expected ErrInvalidAlgorithm, got %v", err)
+	}
+
+	_, _, err = ValidateJWT(valid, testJWTConfig(t, AlgEdDSA))
+	if !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("Expected ErrUnknownKey, got %v", err)
+	}
+
+	_, _, err = ValidateJWT("invalidToken", config)
+	if !errors.Is(err, ErrMalformedToken) {
+		t.Fatalf("Expected ErrMalformedToken, got %v", err)
 	}
 }
 
@@ -92,3 +416,293 @@ func TestGetBearerToken(t *testing.T) {
 	}
 
 }
+
+func TestHashRefreshToken(t *testing.T) {
+	token, err := MakeRefreshToken()
+	if err != nil {
+		t.Fatalf("Failed to create refresh token: %v", err)
+	}
+
+	hash := HashRefreshToken(token)
+	if hash == token {
+		t.Fatal("Hashed refresh token should not equal the raw token")
+	}
+	if len(hash) != 64 {
+		t.Fatalf("Expected a 64 character hex digest, got %d characters", len(hash))
+	}
+	if HashRefreshToken(token) != hash {
+		t.Fatal("Hashing the same refresh token should be deterministic")
+	}
+
+	otherToken, err := MakeRefreshToken()
+	if err != nil {
+		t.Fatalf("Failed to create refresh token: %v", err)
+	}
+	if HashRefreshToken(otherToken) == hash {
+		t.Fatal("Different refresh tokens should not share a hash")
+	}
+}
+
+func TestPersonalAccessToken(t *testing.T) {
+	token, err := MakePersonalAccessToken()
+	if err != nil {
+		t.Fatalf("Failed to create personal access token: %v", err)
+	}
+	if !IsPersonalAccessToken(token) {
+		t.Fatalf("Expected %q to be recognised as a personal access token", token)
+	}
+	if HashPersonalAccessToken(token) == token {
+		t.Fatal("Hashed personal access token should not equal the raw token")
+	}
+
+	jwtToken, err := MakeJWT(uuid.New(), testJWTConfig(t, AlgEdDSA), time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create JWT: %v", err)
+	}
+	if IsPersonalAccessToken(jwtToken) {
+		t.Fatal("A JWT should not be recognised as a personal access token")
+	}
+}
+
+func TestScopes(t *testing.T) {
+	scopes, err := ValidateScopes([]string{ScopeChirpsRead, ScopeChirpsWrite, ScopeChirpsRead})
+	if err != nil {
+		t.Fatalf("Failed to validate scopes: %v", err)
+	}
+	if len(scopes) != 2 {
+		t.Fatalf("Expected duplicate scopes to be removed, got %v", scopes)
+	}
+
+	if _, err := ValidateScopes([]string{"admin"}); err == nil {
+		t.Fatal("Expected an unknown scope to be rejected")
+	}
+	if _, err := ValidateScopes(nil); err == nil {
+		t.Fatal("Expected an empty scope list to be rejected")
+	}
+
+	if err := RequireScope(scopes, ScopeChirpsWrite); err != nil {
+		t.Fatalf("Expected granted scope to pass: %v", err)
+	}
+	err = RequireScope(scopes, ScopeProfileWrite)
+	var scopeErr *ScopeError
+	if !errors.As(err, &scopeErr) || scopeErr.Scope != ScopeProfileWrite {
+		t.Fatalf("Expected a ScopeError for %s, got %v", ScopeProfileWrite, err)
+	}
+}
+
+func TestDelegatedJWT(t *testing.T) {
+	config := testJWTConfig(t, AlgEdDSA)
+	userID := uuid.New()
+
+	token, err := MakeDelegatedJWT(userID, "client-1", []string{ScopeChirpsRead, ScopeChirpsWrite}, config, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create delegated JWT: %v", err)
+	}
+
+	claims, err := ParseJWT(token, config)
+	if err != nil {
+		t.Fatalf("Failed to parse delegated JWT: %v", err)
+	}
+	if !claims.Delegated() || claims.ClientID != "client-1" {
+		t.Fatalf("Expected a token delegated to client-1, got %+v", claims)
+	}
+	if err := RequireScope(claims.Scopes(), ScopeChirpsWrite); err != nil {
+		t.Fatalf("Expected delegated scope to be present: %v", err)
+	}
+	parsedID, err := claims.UserID()
+	if err != nil || parsedID != userID {
+		t.Fatalf("Expected user ID %s, got %s (%v)", userID, parsedID, err)
+	}
+
+	parsedID, scopes, err := ValidateJWT(token, config)
+	if err != nil || parsedID != userID {
+		t.Fatalf("Expected ValidateJWT to accept a delegated token for %s, got %s (%v)", userID, parsedID, err)
+	}
+	if len(scopes) != 2 || scopes[0] != ScopeChirpsRead || scopes[1] != ScopeChirpsWrite {
+		t.Fatalf("Expected the delegated scopes, got %v", scopes)
+	}
+
+	empty, err := MakeDelegatedJWT(userID, "client-1", nil, config, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create delegated JWT: %v", err)
+	}
+	_, scopes, err = ValidateJWT(empty, config)
+	if err != nil || scopes == nil {
+		t.Fatalf("Expected non-nil scopes for a delegated token without any, got %v (%v)", scopes, err)
+	}
+
+	login, err := MakeJWT(userID, config, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create JWT: %v", err)
+	}
+	_, scopes, err = ValidateJWT(login, config)
+	if err != nil || scopes != nil {
+		t.Fatalf("Expected no scopes for a login token, got %v (%v)", scopes, err)
+	}
+}
+
+func TestPKCE(t *testing.T) {
+	// Example from RFC 7636 appendix B.
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	if got := MakeCodeChallenge(verifier); got != challenge {
+		t.Fatalf("Expected challenge %s, got %s", challenge, got)
+	}
+	if err := ValidateCodeChallenge(challenge, "S256"); err != nil {
+		t.Fatalf("Expected challenge to be valid: %v", err)
+	}
+	if err := ValidateCodeChallenge(verifier, "plain"); err == nil {
+		t.Fatal("Expected the plain method to be rejected")
+	}
+	if err := VerifyCodeVerifier(verifier, challenge); err != nil {
+		t.Fatalf("Expected verifier to match: %v", err)
+	}
+	if err := VerifyCodeVerifier(verifier[:len(verifier)-1]+"A", challenge); err == nil {
+		t.Fatal("Expected a different verifier to be rejected")
+	}
+	if err := VerifyCodeVerifier("short", MakeCodeChallenge("short")); err == nil {
+		t.Fatal("Expected a verifier shorter than 43 characters to be rejected")
+	}
+}
+
+func TestTOTP(t *testing.T) {
+	// Test vectors from RFC 6238 appendix B, truncated to six digits.
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tt := range tests {
+		code, err := TOTPCode(secret, TOTPStep(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("Failed to compute TOTP code: %v", err)
+		}
+		if code != tt.code {
+			t.Fatalf("Expected code %s at %d, got %s", tt.code, tt.unix, code)
+		}
+	}
+
+	now := time.Unix(1234567890, 0)
+	step, ok := ValidateTOTP(secret, "005924", now.Add(30*time.Second))
+	if !ok || step != TOTPStep(now) {
+		t.Fatal("Expected a code from the previous step to be accepted")
+	}
+	if _, ok := ValidateTOTP(secret, "005924", now.Add(90*time.Second)); ok {
+		t.Fatal("Expected a code from three steps ago to be rejected")
+	}
+	if _, ok := ValidateTOTP(secret, "000000", now); ok {
+		t.Fatal("Expected a wrong code to be rejected")
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("Failed to generate TOTP secret: %v", err)
+	}
+
+	code, err := TOTPCode(secret, TOTPStep(time.Now()))
+	if err != nil {
+		t.Fatalf("Failed to compute TOTP code: %v", err)
+	}
+	if _, ok := ValidateTOTP(secret, code, time.Now()); !ok {
+		t.Fatal("Expected a freshly computed code to validate")
+	}
+
+	uri := TOTPURI(secret, "Chirpy", "user@example.com")
+	if !strings.HasPrefix(uri, "otpauth://totp/Chirpy:user@example.com?") || !strings.Contains(uri, "secret="+secret) {
+		t.Fatalf("Unexpected otpauth URI %s", uri)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes()
+	if err != nil {
+		t.Fatalf("Failed to generate recovery codes: %v", err)
+	}
+	if len(codes) != 10 {
+		t.Fatalf("Expected 10 recovery codes, got %d", len(codes))
+	}
+
+	code := codes[0]
+	if HashRecoveryCode(strings.ToUpper(strings.ReplaceAll(code, "-", " "))) != HashRecoveryCode(code) {
+		t.Fatal("Expected recovery code hashing to ignore case and separators")
+	}
+	if HashRecoveryCode(codes[1]) == HashRecoveryCode(code) {
+		t.Fatal("Different recovery codes should not share a hash")
+	}
+}
+
+func TestEmailVerificationToken(t *testing.T) {
+	config := testJWTConfig(t, AlgEdDSA)
+	userID := uuid.New()
+
+	token, err := MakeEmailVerificationToken(userID, "new@example.com", config, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create email verification token: %v", err)
+	}
+
+	parsedID, email, err := ValidateEmailVerificationToken(token, config)
+	if err != nil {
+		t.Fatalf("Failed to validate email verification token: %v", err)
+	}
+	if parsedID != userID || email != "new@example.com" {
+		t.Fatalf("Expected %s/new@example.com, got %s/%s", userID, parsedID, email)
+	}
+
+	if _, _, err := ValidateJWT(token, config); !errors.Is(err, ErrInvalidAudience) {
+		t.Fatalf("Expected a verification token to be refused as an access token, got %v", err)
+	}
+
+	accessToken, err := MakeJWT(userID, config, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create JWT: %v", err)
+	}
+	if _, _, err := ValidateEmailVerificationToken(accessToken, config); !errors.Is(err, ErrInvalidAudience) {
+		t.Fatalf("Expected an access token to be refused as a verification token, got %v", err)
+	}
+}
+
+func TestRecentAuthToken(t *testing.T) {
+	config := testJWTConfig(t, AlgEdDSA)
+	userID := uuid.New()
+
+	token, err := MakeRecentAuthToken(userID, config, 5*time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create recent-auth token: %v", err)
+	}
+
+	parsedID, err := ValidateRecentAuthToken(token, config)
+	if err != nil {
+		t.Fatalf("Failed to validate recent-auth token: %v", err)
+	}
+	if parsedID != userID {
+		t.Fatalf("Expected user ID %s, got %s", userID, parsedID)
+	}
+
+	if _, _, err := ValidateJWT(token, config); !errors.Is(err, ErrInvalidAudience) {
+		t.Fatalf("Expected a recent-auth token to be refused as an access token, got %v", err)
+	}
+
+	accessToken, err := MakeJWT(userID, config, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create JWT: %v", err)
+	}
+	if _, err := ValidateRecentAuthToken(accessToken, config); !errors.Is(err, ErrInvalidAudience) {
+		t.Fatalf("Expected an access token to be refused as a recent-auth token, got %v", err)
+	}
+
+	expired, err := MakeRecentAuthToken(userID, config, -time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create recent-auth token: %v", err)
+	}
+	if _, err := ValidateRecentAuthToken(expired, config); !errors.Is(err, ErrExpired) {
+		t.Fatalf("Expected ErrExpired, got %v", err)
+	}
+}
@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const emailVerificationAudience = "email-verification"
+
+type emailVerificationClaims struct {
+	jwt.RegisteredClaims
+	Email string `json:"email"`
+}
+
+// MakeEmailVerificationToken signs a token proving that whoever holds it can
+// read mail sent to email. It is signed with the access token keys but has
+// its own audience, so it can't be used to authenticate requests.
+func MakeEmailVerificationToken(userID uuid.UUID, email string, config JWTConfig, expiresIn time.Duration) (string, error) {
+	claims := &emailVerificationClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    config.Issuer,
+			Audience:  jwt.ClaimStrings{emailVerificationAudience},
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Subject:   userID.String(),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
+		},
+		Email: email,
+	}
+	return signJWT(claims, config)
+}
+
+// ValidateEmailVerificationToken returns the user and address a verification
+// token was issued for.
+func ValidateEmailVerificationToken(tokenString string, config JWTConfig) (uuid.UUID, string, error) {
+	claims := &emailVerificationClaims{}
+	err := parseSignedToken(tokenString, claims, config, emailVerificationAudience)
+	if err != nil {
+		return uuid.Nil, "", err
+	}
+
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil || claims.Email == "" {
+		return uuid.Nil, "", ErrMalformedToken
+	}
+	return userID, claims.Email, nil
+}
@@ -0,0 +1,280 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	AlgEdDSA = "EdDSA"
+	AlgRS256 = "RS256"
+
+	minRSAKeyBits = 2048
+)
+
+// SigningKey is a key used to sign or verify access tokens. Keys loaded from a
+// public key file can only verify.
+type SigningKey struct {
+	ID     string
+	Method jwt.SigningMethod
+
+	private crypto.Signer
+	public  crypto.PublicKey
+}
+
+// GenerateSigningKey creates a new private key for the given algorithm.
+func GenerateSigningKey(alg string) (*SigningKey, error) {
+	switch alg {
+	case AlgEdDSA:
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return newSigningKey(private)
+	case AlgRS256:
+		private, err := rsa.GenerateKey(rand.Reader, minRSAKeyBits)
+		if err != nil {
+			return nil, err
+		}
+		return newSigningKey(private)
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+}
+
+// ParseSigningKeyPEM reads a PEM encoded PKCS#8 or PKCS#1 private key, or a
+// PKIX public key.
+func ParseSigningKeyPEM(data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	var key any
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return newSigningKey(key)
+}
+
+// MarshalPEM encodes the private half of the key as PKCS#8.
+func (k *SigningKey) MarshalPEM() ([]byte, error) {
+	if k.private == nil {
+		return nil, errors.New("key has no private half")
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(k.private)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// CanSign reports whether the key holds a private key.
+func (k *SigningKey) CanSign() bool {
+	return k.private != nil
+}
+
+// LoadSigningKey reads a key from a PEM file.
+func LoadSigningKey(path string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ParseSigningKeyPEM(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return key, nil
+}
+
+// LoadOrCreateSigningKey reads the private key at path, generating one for alg
+// and saving it there first if the file doesn't exist yet.
+func LoadOrCreateSigningKey(path, alg string) (*SigningKey, error) {
+	key, err := LoadSigningKey(path)
+	if err == nil {
+		if !key.CanSign() {
+			return nil, fmt.Errorf("%s: signing key must be a private key", path)
+		}
+		return key, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	key, err = GenerateSigningKey(alg)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := key.MarshalPEM()
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0o700)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.WriteFile(path, data, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+func newSigningKey(key any) (*SigningKey, error) {
+	k := &SigningKey{}
+
+	switch key := key.(type) {
+	case ed25519.PrivateKey:
+		k.Method = jwt.SigningMethodEdDSA
+		k.private = key
+		k.public = key.Public()
+	case ed25519.PublicKey:
+		k.Method = jwt.SigningMethodEdDSA
+		k.public = key
+	case *rsa.PrivateKey:
+		k.Method = jwt.SigningMethodRS256
+		k.private = key
+		k.public = key.Public()
+	case *rsa.PublicKey:
+		k.Method = jwt.SigningMethodRS256
+		k.public = key
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+
+	if rsaKey, ok := k.public.(*rsa.PublicKey); ok && rsaKey.N.BitLen() < minRSAKeyBits {
+		return nil, fmt.Errorf("RSA keys must be at least %d bits", minRSAKeyBits)
+	}
+
+	k.ID = k.JWK().thumbprint()
+	return k, nil
+}
+
+// JWK describes a public key in the JSON Web Key format (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Use string `json:"use,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWK returns the public half of the key.
+func (k *SigningKey) JWK() JWK {
+	jwk := JWK{
+		Kid: k.ID,
+		Alg: k.Method.Alg(),
+		Use: "sig",
+	}
+
+	switch public := k.public.(type) {
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(public)
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+	}
+
+	return jwk
+}
+
+// thumbprint computes the RFC 7638 thumbprint of the key, which is used as
+// its key ID so that the same key file always gets the same kid.
+func (j JWK) thumbprint() string {
+	var canonical string
+	switch j.Kty {
+	case "OKP":
+		canonical = fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q}`, j.Crv, j.Kty, j.X)
+	case "RSA":
+		canonical = fmt.Sprintf(`{"e":%q,"kty":%q,"n":%q}`, j.E, j.Kty, j.N)
+	}
+
+	sum := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// Keyring holds the key new tokens are signed with and every key tokens are
+// still accepted from. Rotating keys means making a new key active while the
+// old one stays around for verification until the tokens it signed expire.
+type Keyring struct {
+	active  *SigningKey
+	keys    map[string]*SigningKey
+	ordered []*SigningKey
+}
+
+func NewKeyring(active *SigningKey, verification ...*SigningKey) (*Keyring, error) {
+	if active == nil || !active.CanSign() {
+		return nil, errors.New("active key must be a private key")
+	}
+
+	keyring := &Keyring{
+		active:  active,
+		keys:    map[string]*SigningKey{active.ID: active},
+		ordered: []*SigningKey{active},
+	}
+	for _, key := range verification {
+		if _, ok := keyring.keys[key.ID]; ok {
+			continue
+		}
+		keyring.keys[key.ID] = key
+		keyring.ordered = append(keyring.ordered, key)
+	}
+
+	return keyring, nil
+}
+
+// Lookup finds a key by its ID.
+func (k *Keyring) Lookup(kid string) (*SigningKey, bool) {
+	key, ok := k.keys[kid]
+	return key, ok
+}
+
+// JWKS returns the public keys of every key in the ring, active key first.
+func (k *Keyring) JWKS() JWKSet {
+	set := JWKSet{Keys: make([]JWK, 0, len(k.ordered))}
+	for _, key := range k.ordered {
+		set.Keys = append(set.Keys, key.JWK())
+	}
+	return set
+}
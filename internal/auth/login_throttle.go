@@ -0,0 +1,99 @@
+package auth
+
+import "time"
+
+// LoginThrottle describes how failed logins against one subject, such as an
+// email address or a client IP, slow down further attempts.
+type LoginThrottle struct {
+	// FreeAttempts failures are allowed before any delay is imposed.
+	FreeAttempts int
+	// BaseDelay is the delay after the first failure past FreeAttempts. It
+	// doubles with every further failure, up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Once a subject reaches LockoutAfter failures it is locked out for
+	// LockoutDuration after each further failure. Zero disables lockout.
+	LockoutAfter    int
+	LockoutDuration time.Duration
+	// Window is how long failures are remembered after the most recent one.
+	Window time.Duration
+}
+
+// DefaultEmailThrottle lets a user mistype their password a few times, then
+// backs off exponentially and locks the account for 15 minutes after ten
+// failures in a row.
+var DefaultEmailThrottle = LoginThrottle{
+	FreeAttempts:    3,
+	BaseDelay:       time.Second,
+	MaxDelay:        time.Minute,
+	LockoutAfter:    10,
+	LockoutDuration: 15 * time.Minute,
+	Window:          time.Hour,
+}
+
+// DefaultIPThrottle is looser than DefaultEmailThrottle because many users
+// can share an address, but still stops one client guessing across many
+// accounts.
+var DefaultIPThrottle = LoginThrottle{
+	FreeAttempts:    20,
+	BaseDelay:       time.Second,
+	MaxDelay:        time.Minute,
+	LockoutAfter:    100,
+	LockoutDuration: time.Hour,
+	Window:          time.Hour,
+}
+
+// DefaultResetEmailThrottle limits how often password reset emails can be
+// requested for one address, so the endpoint can't be used to flood an inbox.
+// Every request counts, not only failed ones.
+var DefaultResetEmailThrottle = LoginThrottle{
+	FreeAttempts: 2,
+	BaseDelay:    time.Minute,
+	MaxDelay:     time.Hour,
+	Window:       24 * time.Hour,
+}
+
+// DefaultResetIPThrottle limits how many password resets one client can
+// request across all addresses.
+var DefaultResetIPThrottle = LoginThrottle{
+	FreeAttempts: 10,
+	BaseDelay:    time.Minute,
+	MaxDelay:     time.Hour,
+	Window:       time.Hour,
+}
+
+// Delay returns how long a subject must wait before trying again after its
+// nth failure within the window.
+func (t LoginThrottle) Delay(failures int) time.Duration {
+	if t.LockoutAfter > 0 && failures >= t.LockoutAfter {
+		return t.LockoutDuration
+	}
+	if failures <= t.FreeAttempts {
+		return 0
+	}
+
+	delay := t.BaseDelay
+	for i := t.FreeAttempts + 1; i < failures && delay < t.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, t.MaxDelay)
+}
+
+// Schedule lists Delay in whole seconds for the 1st, 2nd, ... failure, up to
+// the point where it stops changing; later failures use the last entry. It
+// lets the database apply the throttle in the same statement that counts the
+// failure.
+func (t LoginThrottle) Schedule() []int32 {
+	var schedule []int32
+	for n := 1; n <= 1000; n++ {
+		delay := t.Delay(n)
+		schedule = append(schedule, int32(delay/time.Second))
+		if t.LockoutAfter > 0 && n >= t.LockoutAfter {
+			break
+		}
+		if t.LockoutAfter == 0 && n > t.FreeAttempts && delay >= t.MaxDelay {
+			break
+		}
+	}
+	return schedule
+}
@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+//go:embed common_passwords.txt
+var commonPasswords string
+
+// Password policy violation codes, stable for clients to match on.
+const (
+	PasswordTooShort = "too_short"
+	PasswordTooLong  = "too_long"
+	PasswordCommon   = "common_password"
+)
+
+// PasswordViolation is one way a password fails the policy.
+type PasswordViolation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// PasswordPolicy decides which passwords are accepted for new and changed
+// passwords. Existing passwords are never rechecked.
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+	blocked   map[string]struct{}
+}
+
+// NewPasswordPolicy builds a policy that rejects passwords shorter than
+// minLength or longer than maxLength characters, and any password on the
+// bundled common password list or in the extra blocklists. Blocklists have
+// one password per line; blank lines and lines starting with # are skipped.
+func NewPasswordPolicy(minLength, maxLength int, blocklists ...io.Reader) (*PasswordPolicy, error) {
+	if minLength < 1 {
+		return nil, fmt.Errorf("minimum password length must be at least 1, got %d", minLength)
+	}
+	if maxLength < minLength {
+		return nil, fmt.Errorf("maximum password length %d is below the minimum %d", maxLength, minLength)
+	}
+
+	policy := &PasswordPolicy{
+		MinLength: minLength,
+		MaxLength: maxLength,
+		blocked:   make(map[string]struct{}),
+	}
+
+	blocklists = append([]io.Reader{strings.NewReader(commonPasswords)}, blocklists...)
+	for _, list := range blocklists {
+		scanner := bufio.NewScanner(list)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			policy.blocked[strings.ToLower(line)] = struct{}{}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("reading password blocklist: %w", err)
+		}
+	}
+
+	return policy, nil
+}
+
+// Validate returns every rule the password breaks, or nil if it is
+// acceptable. Length is counted in characters rather than bytes.
+func (p *PasswordPolicy) Validate(password string) []PasswordViolation {
+	var violations []PasswordViolation
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		violations = append(violations, PasswordViolation{
+			Code:    PasswordTooShort,
+			Message: fmt.Sprintf("Password must be at least %d characters", p.MinLength),
+		})
+	}
+	if length > p.MaxLength {
+		violations = append(violations, PasswordViolation{
+			Code:    PasswordTooLong,
+			Message: fmt.Sprintf("Password must be at most %d characters", p.MaxLength),
+		})
+	}
+
+	if _, ok := p.blocked[strings.ToLower(password)]; ok {
+		violations = append(violations, PasswordViolation{
+			Code:    PasswordCommon,
+			Message: "Password is too common and appears in lists of breached passwords",
+		})
+	}
+
+	return violations
+}
@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Personal access tokens carry a fixed prefix so they can be told apart from
+// JWTs without a database lookup, and so leaked tokens are easy to scan for.
+const personalAccessTokenPrefix = "chirpy_pat_"
+
+const (
+	ScopeChirpsRead   = "chirps:read"
+	ScopeChirpsWrite  = "chirps:write"
+	ScopeFollowsWrite = "follows:write"
+	ScopeProfileWrite = "profile:write"
+)
+
+// Scopes lists every scope a personal access token can be granted.
+var Scopes = []string{
+	ScopeChirpsRead,
+	ScopeChirpsWrite,
+	ScopeFollowsWrite,
+	ScopeProfileWrite,
+}
+
+var ErrUnknownToken = errors.New("token is unknown, revoked or expired")
+
+// ScopeError is returned when a token is valid but was not granted the scope
+// an endpoint requires.
+type ScopeError struct {
+	Scope string
+}
+
+func (e *ScopeError) Error() string {
+	return fmt.Sprintf("token is missing the %s scope", e.Scope)
+}
+
+func MakePersonalAccessToken() (string, error) {
+	token := make([]byte, 32)
+	_, err := rand.Read(token)
+	if err != nil {
+		return "", err
+	}
+
+	return personalAccessTokenPrefix + hex.EncodeToString(token), nil
+}
+
+// IsPersonalAccessToken reports whether a bearer token looks like a personal
+// access token rather than a JWT.
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, personalAccessTokenPrefix)
+}
+
+// HashPersonalAccessToken returns the digest stored for a personal access
+// token. Like refresh tokens they are long and random, so SHA-256 is enough.
+func HashPersonalAccessToken(token string) string {
+	return HashRefreshToken(token)
+}
+
+// ValidateScopes checks that every requested scope exists and returns them
+// without duplicates.
+func ValidateScopes(requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		return nil, errors.New("at least one scope is required")
+	}
+
+	var scopes []string
+	for _, scope := range requested {
+		if !slices.Contains(Scopes, scope) {
+			return nil, fmt.Errorf("unknown scope %q", scope)
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, nil
+}
+
+// RequireScope returns a *ScopeError unless scope is among granted.
+func RequireScope(granted []string, scope string) error {
+	if !slices.Contains(granted, scope) {
+		return &ScopeError{Scope: scope}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"regexp"
+)
+
+// PKCE verifiers are 43 to 128 characters from the unreserved URL set
+// (RFC 7636 section 4.1).
+var codeVerifierRegex = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+
+// S256 challenges are the unpadded base64url SHA-256 digest of the verifier.
+var codeChallengeRegex = regexp.MustCompile(`^[A-Za-z0-9\-_]{43}$`)
+
+var ErrInvalidCodeVerifier = errors.New("code verifier does not match the code challenge")
+
+// ValidateCodeChallenge checks that a client sent a well-formed S256 code
+// challenge. The "plain" method is not supported.
+func ValidateCodeChallenge(challenge, method string) error {
+	if method != "S256" {
+		return errors.New("code_challenge_method must be S256")
+	}
+	if !codeChallengeRegex.MatchString(challenge) {
+		return errors.New("code_challenge is malformed")
+	}
+	return nil
+}
+
+// MakeCodeChallenge derives the S256 challenge for a verifier.
+func MakeCodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// VerifyCodeVerifier checks a PKCE verifier against the challenge the client
+// sent when it asked for the authorization code.
+func VerifyCodeVerifier(verifier, challenge string) error {
+	if !codeVerifierRegex.MatchString(verifier) {
+		return ErrInvalidCodeVerifier
+	}
+	if subtle.ConstantTimeCompare([]byte(MakeCodeChallenge(verifier)), []byte(challenge)) != 1 {
+		return ErrInvalidCodeVerifier
+	}
+	return nil
+}
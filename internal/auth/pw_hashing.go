@@ -1,19 +1,212 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
 )
 
-// HashPassword hashes a password using bcrypt with a default cost.
-func HashPassword(password string) (string, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+var (
+	ErrPasswordMismatch   = errors.New("password does not match")
+	ErrUnknownHashFormat  = errors.New("unrecognised password hash format")
+	ErrMalformedArgonHash = errors.New("malformed argon2id hash")
+)
+
+// PasswordHasher turns passwords into self-describing hash strings, so a
+// hash records the algorithm and parameters it was made with.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// Verify returns nil if password matches hash.
+	Verify(hash, password string) error
+	// NeedsRehash reports whether hash was made with another algorithm or
+	// with different parameters and should be replaced next time the
+	// password is known.
+	NeedsRehash(hash string) bool
+}
+
+// Argon2Params tunes argon2id. Memory is in KiB.
+type Argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2Params follow the second recommended option in RFC 9106
+// section 4, scaled down to 64 MiB for a web server.
+var DefaultArgon2Params = Argon2Params{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// MaxArgon2Params bounds the parameters a stored hash may ask for. Hashes
+// are only ever written by this package, but one planted in the database
+// with huge parameters would otherwise make every login for it exhaust the
+// server's memory or CPU.
+var MaxArgon2Params = Argon2Params{
+	Memory:      1024 * 1024,
+	Iterations:  16,
+	Parallelism: 16,
+	SaltLength:  64,
+	KeyLength:   64,
+}
+
+// Argon2idHasher hashes new passwords with argon2id, encoded in the PHC
+// string format. It still verifies bcrypt hashes from before argon2id was
+// introduced, and reports them as needing a rehash.
+type Argon2idHasher struct {
+	Params Argon2Params
+}
+
+func (h Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.Params.SaltLength)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.Params.Iterations, h.Params.Memory, h.Params.Parallelism, h.Params.KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		h.Params.Memory,
+		h.Params.Iterations,
+		h.Params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h Argon2idHasher) Verify(hash, password string) error {
+	if isBcryptHash(hash) {
+		return BcryptHasher{}.Verify(hash, password)
+	}
+
+	params, salt, key, err := decodeArgon2idHash(hash)
+	if err != nil {
+		return err
+	}
+
+	candidate := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	if subtle.ConstantTimeCompare(candidate, key) != 1 {
+		return ErrPasswordMismatch
+	}
+	return nil
+}
+
+func (h Argon2idHasher) NeedsRehash(hash string) bool {
+	params, _, _, err := decodeArgon2idHash(hash)
+	if err != nil {
+		return true
+	}
+	return params != h.Params
+}
+
+// decodeArgon2idHash parses $argon2id$v=19$m=...,t=...,p=...$salt$key.
+func decodeArgon2idHash(hash string) (Argon2Params, []byte, []byte, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[0] != "" {
+		return Argon2Params{}, nil, nil, ErrUnknownHashFormat
+	}
+	if parts[1] != "argon2id" {
+		return Argon2Params{}, nil, nil, ErrUnknownHashFormat
+	}
+
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return Argon2Params{}, nil, nil, ErrMalformedArgonHash
+	}
+
+	var params Argon2Params
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism)
+	if err != nil || params.Iterations == 0 || params.Parallelism == 0 {
+		return Argon2Params{}, nil, nil, ErrMalformedArgonHash
+	}
+	if params.Memory > MaxArgon2Params.Memory || params.Iterations > MaxArgon2Params.Iterations ||
+		params.Parallelism > MaxArgon2Params.Parallelism {
+		return Argon2Params{}, nil, nil, ErrMalformedArgonHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Argon2Params{}, nil, nil, ErrMalformedArgonHash
+	}
+	if len(salt) > int(MaxArgon2Params.SaltLength) {
+		return Argon2Params{}, nil, nil, ErrMalformedArgonHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 || len(key) > int(MaxArgon2Params.KeyLength) {
+		return Argon2Params{}, nil, nil, ErrMalformedArgonHash
+	}
+
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	return params, salt, key, nil
+}
+
+// BcryptHasher is the original hasher. bcrypt ignores everything after the
+// first 72 bytes of a password, which is why new hashes use argon2id.
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h BcryptHasher) Hash(password string) (string, error) {
+	cost := h.Cost
+	if cost == 0 {
+		cost = bcrypt.DefaultCost
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), cost)
 	if err != nil {
 		return "", err
 	}
 	return string(hashedPassword), nil
 }
 
-// CheckPasswordHash checks if the provided password matches the hashed password.
+func (h BcryptHasher) Verify(hash, password string) error {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrPasswordMismatch
+	}
+	return err
+}
+
+func (h BcryptHasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return true
+	}
+	want := h.Cost
+	if want == 0 {
+		want = bcrypt.DefaultCost
+	}
+	return cost != want
+}
+
+func isBcryptHash(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+var defaultHasher PasswordHasher = Argon2idHasher{Params: DefaultArgon2Params}
+
+// HashPassword hashes a password with argon2id and the default parameters.
+func HashPassword(password string) (string, error) {
+	return defaultHasher.Hash(password)
+}
+
+// CheckPasswordHash checks if the provided password matches the hashed
+// password, which may be an argon2id or a legacy bcrypt hash.
 func CheckPasswordHash(hashedPassword, password string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+	return defaultHasher.Verify(hashedPassword, password)
 }
@@ -2,6 +2,7 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 )
 
@@ -16,3 +17,12 @@ func MakeRefreshToken() (string, error) {
 	// Return the token as a hexadecimal string
 	return hex.EncodeToString(token), nil
 }
+
+// HashRefreshToken returns the SHA-256 digest of a refresh token as a hex
+// string. Only the digest is stored, so reading the database is not enough
+// to hijack a session. Refresh tokens are long and random, so an unsalted
+// fast hash is sufficient here, unlike for passwords.
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -7,23 +7,43 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const chirpHasReplies = `-- name: ChirpHasReplies :one
+SELECT EXISTS (SELECT 1 FROM chirps WHERE parent_id = $1) AS has_replies
+`
+
+func (q *Queries) ChirpHasReplies(ctx context.Context, parentID uuid.NullUUID) (bool, error) {
+	row := q.db.QueryRowContext(ctx, chirpHasReplies, parentID)
+	var hasReplies bool
+	err := row.Scan(&hasReplies)
+	return hasReplies, err
+}
+
 const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirps (id, body, created_at, updated_at, user_id)
-VALUES (gen_random_uuid(), $1, NOW(), NOW(), $2)
-RETURNING id, body, created_at, updated_at, user_id
+INSERT INTO chirps (id, body, created_at, updated_at, user_id, parent_id, quote_of_id)
+VALUES (gen_random_uuid(), $1, NOW(), NOW(), $2, $3, $4)
+RETURNING id, body, created_at, updated_at, user_id, parent_id, reply_count, deleted_at, like_count, rechirp_of_id, quote_of_id, search_vector, hidden_at
 `
 
 type CreateChirpParams struct {
-	Body   string
-	UserID uuid.UUID
+	Body      string
+	UserID    uuid.UUID
+	ParentID  uuid.NullUUID
+	QuoteOfID uuid.NullUUID
 }
 
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp,
+		arg.Body,
+		arg.UserID,
+		arg.ParentID,
+		arg.QuoteOfID,
+	)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -31,6 +51,47 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.UserID,
+		&i.ParentID,
+		&i.ReplyCount,
+		&i.DeletedAt,
+		&i.LikeCount,
+		&i.RechirpOfID,
+		&i.QuoteOfID,
+		&i.SearchVector,
+		&i.HiddenAt,
+	)
+	return i, err
+}
+
+const createRechirp = `-- name: CreateRechirp :one
+INSERT INTO chirps (id, body, created_at, updated_at, user_id, rechirp_of_id)
+VALUES (gen_random_uuid(), '', NOW(), NOW(), $1, $2::uuid)
+ON CONFLICT (user_id, rechirp_of_id) WHERE rechirp_of_id IS NOT NULL DO NOTHING
+RETURNING id, body, created_at, updated_at, user_id, parent_id, reply_count, deleted_at, like_count, rechirp_of_id, quote_of_id, search_vector, hidden_at
+`
+
+type CreateRechirpParams struct {
+	UserID  uuid.UUID
+	ChirpID uuid.UUID
+}
+
+func (q *Queries) CreateRechirp(ctx context.Context, arg CreateRechirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, createRechirp, arg.UserID, arg.ChirpID)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.Body,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.ParentID,
+		&i.ReplyCount,
+		&i.DeletedAt,
+		&i.LikeCount,
+		&i.RechirpOfID,
+		&i.QuoteOfID,
+		&i.SearchVector,
+		&i.HiddenAt,
 	)
 	return i, err
 }
@@ -45,9 +106,91 @@ func (q *Queries) DeleteChirpByID(ctx context.Context, id uuid.UUID) error {
 	return err
 }
 
+const deleteRechirp = `-- name: DeleteRechirp :execrows
+DELETE FROM chirps
+WHERE user_id = $1 AND rechirp_of_id = $2::uuid
+`
+
+type DeleteRechirpParams struct {
+	UserID  uuid.UUID
+	ChirpID uuid.UUID
+}
+
+func (q *Queries) DeleteRechirp(ctx context.Context, arg DeleteRechirpParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteRechirp, arg.UserID, arg.ChirpID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteRechirpsOf = `-- name: DeleteRechirpsOf :exec
+DELETE FROM chirps
+WHERE rechirp_of_id = $1::uuid
+`
+
+func (q *Queries) DeleteRechirpsOf(ctx context.Context, chirpID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteRechirpsOf, chirpID)
+	return err
+}
+
+const getChirpAncestors = `-- name: GetChirpAncestors :many
+WITH RECURSIVE ancestors AS (
+    SELECT parent.id, parent.parent_id, 1 AS depth
+    FROM chirps parent
+    WHERE parent.id = (SELECT child.parent_id FROM chirps child WHERE child.id = $1)
+      AND parent.hidden_at IS NULL
+    UNION ALL
+    SELECT parent.id, parent.parent_id, ancestors.depth + 1
+    FROM chirps parent
+    JOIN ancestors ON parent.id = ancestors.parent_id
+    WHERE parent.hidden_at IS NULL
+)
+SELECT chirps.id, chirps.body, chirps.created_at, chirps.updated_at, chirps.user_id, chirps.parent_id, chirps.reply_count, chirps.deleted_at, chirps.like_count, chirps.rechirp_of_id, chirps.quote_of_id, chirps.search_vector, chirps.hidden_at FROM chirps
+JOIN ancestors ON chirps.id = ancestors.id
+ORDER BY ancestors.depth DESC
+`
+
+func (q *Queries) GetChirpAncestors(ctx context.Context, id uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpAncestors, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.Body,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.ParentID,
+			&i.ReplyCount,
+			&i.DeletedAt,
+			&i.LikeCount,
+			&i.RechirpOfID,
+			&i.QuoteOfID,
+			&i.SearchVector,
+			&i.HiddenAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getChirpByID = `-- name: GetChirpByID :one
-SELECT id, body, created_at, updated_at, user_id FROM chirps
-WHERE id = $1
+SELECT id, body, created_at, updated_at, user_id, parent_id, reply_count, deleted_at, like_count, rechirp_of_id, quote_of_id, search_vector, hidden_at FROM chirps
+WHERE id = $1 AND deleted_at IS NULL AND hidden_at IS NULL
 `
 
 func (q *Queries) GetChirpByID(ctx context.Context, id uuid.UUID) (Chirp, error) {
@@ -59,17 +202,461 @@ func (q *Queries) GetChirpByID(ctx context.Context, id uuid.UUID) (Chirp, error)
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.UserID,
+		&i.ParentID,
+		&i.ReplyCount,
+		&i.DeletedAt,
+		&i.LikeCount,
+		&i.RechirpOfID,
+		&i.QuoteOfID,
+		&i.SearchVector,
+		&i.HiddenAt,
 	)
 	return i, err
 }
 
-const getChirps = `-- name: GetChirps :many
-SELECT id, body, created_at, updated_at, user_id FROM chirps
-ORDER BY created_at ASC
+const getChirpReplies = `-- name: GetChirpReplies :many
+WITH RECURSIVE replies AS (
+    SELECT child.id
+    FROM chirps child
+    WHERE child.parent_id = $1::uuid
+      AND child.hidden_at IS NULL
+    UNION ALL
+    SELECT child.id
+    FROM chirps child
+    JOIN replies ON child.parent_id = replies.id
+    WHERE child.hidden_at IS NULL
+)
+SELECT chirps.id, chirps.body, chirps.created_at, chirps.updated_at, chirps.user_id, chirps.parent_id, chirps.reply_count, chirps.deleted_at, chirps.like_count, chirps.rechirp_of_id, chirps.quote_of_id, chirps.search_vector, chirps.hidden_at FROM chirps
+JOIN replies ON chirps.id = replies.id
+ORDER BY chirps.created_at ASC, chirps.id ASC
+`
+
+func (q *Queries) GetChirpReplies(ctx context.Context, chirpID uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpReplies, chirpID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.Body,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.ParentID,
+			&i.ReplyCount,
+			&i.DeletedAt,
+			&i.LikeCount,
+			&i.RechirpOfID,
+			&i.QuoteOfID,
+			&i.SearchVector,
+			&i.HiddenAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpsByIDs = `-- name: GetChirpsByIDs :many
+SELECT id, body, created_at, updated_at, user_id, parent_id, reply_count, deleted_at, like_count, rechirp_of_id, quote_of_id, search_vector, hidden_at FROM chirps
+WHERE id = ANY($1::uuid[]) AND deleted_at IS NULL AND hidden_at IS NULL
+`
+
+func (q *Queries) GetChirpsByIDs(ctx context.Context, ids []uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsByIDs, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.Body,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.ParentID,
+			&i.ReplyCount,
+			&i.DeletedAt,
+			&i.LikeCount,
+			&i.RechirpOfID,
+			&i.QuoteOfID,
+			&i.SearchVector,
+			&i.HiddenAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getReferencedChirps = `-- name: GetReferencedChirps :many
+SELECT id, body, created_at, updated_at, user_id, parent_id, reply_count, deleted_at, like_count, rechirp_of_id, quote_of_id, search_vector, hidden_at FROM chirps
+WHERE id = ANY($1::uuid[]) AND hidden_at IS NULL
+`
+
+func (q *Queries) GetReferencedChirps(ctx context.Context, ids []uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getReferencedChirps, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.Body,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.ParentID,
+			&i.ReplyCount,
+			&i.DeletedAt,
+			&i.LikeCount,
+			&i.RechirpOfID,
+			&i.QuoteOfID,
+			&i.SearchVector,
+			&i.HiddenAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const hideUserChirps = `-- name: HideUserChirps :exec
+UPDATE chirps
+SET hidden_at = NOW()
+WHERE hidden_at IS NULL
+  AND (user_id = $1 OR rechirp_of_id IN (SELECT id FROM chirps WHERE user_id = $1))
+`
+
+func (q *Queries) HideUserChirps(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, hideUserChirps, userID)
+	return err
+}
+
+const listChirpsAsc = `-- name: ListChirpsAsc :many
+SELECT id, body, created_at, updated_at, user_id, parent_id, reply_count, deleted_at, like_count, rechirp_of_id, quote_of_id, search_vector, hidden_at FROM chirps
+WHERE deleted_at IS NULL AND hidden_at IS NULL
+  AND ($1::uuid IS NULL OR user_id = $1::uuid)
+  AND ($2::timestamp IS NULL
+    OR (created_at, id) > ($2::timestamp, $3::uuid))
+  AND ($4::timestamp IS NULL
+    OR (created_at, id) < ($4::timestamp, $5::uuid))
+ORDER BY created_at ASC, id ASC
+LIMIT $6
+`
+
+type ListChirpsAscParams struct {
+	AuthorID        uuid.NullUUID
+	AfterCreatedAt  sql.NullTime
+	AfterID         uuid.NullUUID
+	BeforeCreatedAt sql.NullTime
+	BeforeID        uuid.NullUUID
+	PageLimit       int32
+}
+
+func (q *Queries) ListChirpsAsc(ctx context.Context, arg ListChirpsAscParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsAsc,
+		arg.AuthorID,
+		arg.AfterCreatedAt,
+		arg.AfterID,
+		arg.BeforeCreatedAt,
+		arg.BeforeID,
+		arg.PageLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.Body,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.ParentID,
+			&i.ReplyCount,
+			&i.DeletedAt,
+			&i.LikeCount,
+			&i.RechirpOfID,
+			&i.QuoteOfID,
+			&i.SearchVector,
+			&i.HiddenAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpsDesc = `-- name: ListChirpsDesc :many
+SELECT id, body, created_at, updated_at, user_id, parent_id, reply_count, deleted_at, like_count, rechirp_of_id, quote_of_id, search_vector, hidden_at FROM chirps
+WHERE deleted_at IS NULL AND hidden_at IS NULL
+  AND ($1::uuid IS NULL OR user_id = $1::uuid)
+  AND ($2::timestamp IS NULL
+    OR (created_at, id) > ($2::timestamp, $3::uuid))
+  AND ($4::timestamp IS NULL
+    OR (created_at, id) < ($4::timestamp, $5::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT $6
+`
+
+type ListChirpsDescParams struct {
+	AuthorID        uuid.NullUUID
+	AfterCreatedAt  sql.NullTime
+	AfterID         uuid.NullUUID
+	BeforeCreatedAt sql.NullTime
+	BeforeID        uuid.NullUUID
+	PageLimit       int32
+}
+
+func (q *Queries) ListChirpsDesc(ctx context.Context, arg ListChirpsDescParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsDesc,
+		arg.AuthorID,
+		arg.AfterCreatedAt,
+		arg.AfterID,
+		arg.BeforeCreatedAt,
+		arg.BeforeID,
+		arg.PageLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.Body,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.ParentID,
+			&i.ReplyCount,
+			&i.DeletedAt,
+			&i.LikeCount,
+			&i.RechirpOfID,
+			&i.QuoteOfID,
+			&i.SearchVector,
+			&i.HiddenAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listHashtagChirpsAsc = `-- name: ListHashtagChirpsAsc :many
+SELECT chirps.id, chirps.body, chirps.created_at, chirps.updated_at, chirps.user_id, chirps.parent_id, chirps.reply_count, chirps.deleted_at, chirps.like_count, chirps.rechirp_of_id, chirps.quote_of_id, chirps.search_vector, chirps.hidden_at FROM chirps
+JOIN chirp_hashtags ON chirp_hashtags.chirp_id = chirps.id
+WHERE chirp_hashtags.tag = $1
+  AND chirps.deleted_at IS NULL AND chirps.hidden_at IS NULL
+  AND ($2::timestamp IS NULL
+    OR (chirps.created_at, chirps.id) > ($2::timestamp, $3::uuid))
+  AND ($4::timestamp IS NULL
+    OR (chirps.created_at, chirps.id) < ($4::timestamp, $5::uuid))
+ORDER BY chirps.created_at ASC, chirps.id ASC
+LIMIT $6
+`
+
+type ListHashtagChirpsAscParams struct {
+	Tag             string
+	AfterCreatedAt  sql.NullTime
+	AfterID         uuid.NullUUID
+	BeforeCreatedAt sql.NullTime
+	BeforeID        uuid.NullUUID
+	PageLimit       int32
+}
+
+func (q *Queries) ListHashtagChirpsAsc(ctx context.Context, arg ListHashtagChirpsAscParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listHashtagChirpsAsc,
+		arg.Tag,
+		arg.AfterCreatedAt,
+		arg.AfterID,
+		arg.BeforeCreatedAt,
+		arg.BeforeID,
+		arg.PageLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.Body,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.ParentID,
+			&i.ReplyCount,
+			&i.DeletedAt,
+			&i.LikeCount,
+			&i.RechirpOfID,
+			&i.QuoteOfID,
+			&i.SearchVector,
+			&i.HiddenAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listHashtagChirpsDesc = `-- name: ListHashtagChirpsDesc :many
+SELECT chirps.id, chirps.body, chirps.created_at, chirps.updated_at, chirps.user_id, chirps.parent_id, chirps.reply_count, chirps.deleted_at, chirps.like_count, chirps.rechirp_of_id, chirps.quote_of_id, chirps.search_vector, chirps.hidden_at FROM chirps
+JOIN chirp_hashtags ON chirp_hashtags.chirp_id = chirps.id
+WHERE chirp_hashtags.tag = $1
+  AND chirps.deleted_at IS NULL AND chirps.hidden_at IS NULL
+  AND ($2::timestamp IS NULL
+    OR (chirps.created_at, chirps.id) > ($2::timestamp, $3::uuid))
+  AND ($4::timestamp IS NULL
+    OR (chirps.created_at, chirps.id) < ($4::timestamp, $5::uuid))
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT $6
+`
+
+type ListHashtagChirpsDescParams struct {
+	Tag             string
+	AfterCreatedAt  sql.NullTime
+	AfterID         uuid.NullUUID
+	BeforeCreatedAt sql.NullTime
+	BeforeID        uuid.NullUUID
+	PageLimit       int32
+}
+
+func (q *Queries) ListHashtagChirpsDesc(ctx context.Context, arg ListHashtagChirpsDescParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listHashtagChirpsDesc,
+		arg.Tag,
+		arg.AfterCreatedAt,
+		arg.AfterID,
+		arg.BeforeCreatedAt,
+		arg.BeforeID,
+		arg.PageLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.Body,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.ParentID,
+			&i.ReplyCount,
+			&i.DeletedAt,
+			&i.LikeCount,
+			&i.RechirpOfID,
+			&i.QuoteOfID,
+			&i.SearchVector,
+			&i.HiddenAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listMentionChirps = `-- name: ListMentionChirps :many
+SELECT chirps.id, chirps.body, chirps.created_at, chirps.updated_at, chirps.user_id, chirps.parent_id, chirps.reply_count, chirps.deleted_at, chirps.like_count, chirps.rechirp_of_id, chirps.quote_of_id, chirps.search_vector, chirps.hidden_at FROM chirps
+JOIN chirp_mentions ON chirp_mentions.chirp_id = chirps.id
+WHERE chirp_mentions.user_id = $1
+  AND chirps.deleted_at IS NULL AND chirps.hidden_at IS NULL
+  AND ($2::timestamp IS NULL
+    OR (chirps.created_at, chirps.id) > ($2::timestamp, $3::uuid))
+  AND ($4::timestamp IS NULL
+    OR (chirps.created_at, chirps.id) < ($4::timestamp, $5::uuid))
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT $6
 `
 
-func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirps)
+type ListMentionChirpsParams struct {
+	UserID          uuid.UUID
+	AfterCreatedAt  sql.NullTime
+	AfterID         uuid.NullUUID
+	BeforeCreatedAt sql.NullTime
+	BeforeID        uuid.NullUUID
+	PageLimit       int32
+}
+
+func (q *Queries) ListMentionChirps(ctx context.Context, arg ListMentionChirpsParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listMentionChirps,
+		arg.UserID,
+		arg.AfterCreatedAt,
+		arg.AfterID,
+		arg.BeforeCreatedAt,
+		arg.BeforeID,
+		arg.PageLimit,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -83,6 +670,14 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.UserID,
+			&i.ParentID,
+			&i.ReplyCount,
+			&i.DeletedAt,
+			&i.LikeCount,
+			&i.RechirpOfID,
+			&i.QuoteOfID,
+			&i.SearchVector,
+			&i.HiddenAt,
 		); err != nil {
 			return nil, err
 		}
@@ -97,14 +692,37 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 	return items, nil
 }
 
-const getChirpsByUserID = `-- name: GetChirpsByUserID :many
-SELECT id, body, created_at, updated_at, user_id FROM chirps
-WHERE user_id = $1
-ORDER BY created_at ASC
+const listTimelineAsc = `-- name: ListTimelineAsc :many
+SELECT id, body, created_at, updated_at, user_id, parent_id, reply_count, deleted_at, like_count, rechirp_of_id, quote_of_id, search_vector, hidden_at FROM chirps
+WHERE deleted_at IS NULL AND hidden_at IS NULL
+  AND (user_id = $1
+    OR user_id IN (SELECT followee_id FROM follows WHERE follower_id = $1))
+  AND ($2::timestamp IS NULL
+    OR (created_at, id) > ($2::timestamp, $3::uuid))
+  AND ($4::timestamp IS NULL
+    OR (created_at, id) < ($4::timestamp, $5::uuid))
+ORDER BY created_at ASC, id ASC
+LIMIT $6
 `
 
-func (q *Queries) GetChirpsByUserID(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirpsByUserID, userID)
+type ListTimelineAscParams struct {
+	UserID          uuid.UUID
+	AfterCreatedAt  sql.NullTime
+	AfterID         uuid.NullUUID
+	BeforeCreatedAt sql.NullTime
+	BeforeID        uuid.NullUUID
+	PageLimit       int32
+}
+
+func (q *Queries) ListTimelineAsc(ctx context.Context, arg ListTimelineAscParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listTimelineAsc,
+		arg.UserID,
+		arg.AfterCreatedAt,
+		arg.AfterID,
+		arg.BeforeCreatedAt,
+		arg.BeforeID,
+		arg.PageLimit,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -118,6 +736,14 @@ func (q *Queries) GetChirpsByUserID(ctx context.Context, userID uuid.UUID) ([]Ch
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.UserID,
+			&i.ParentID,
+			&i.ReplyCount,
+			&i.DeletedAt,
+			&i.LikeCount,
+			&i.RechirpOfID,
+			&i.QuoteOfID,
+			&i.SearchVector,
+			&i.HiddenAt,
 		); err != nil {
 			return nil, err
 		}
@@ -131,3 +757,227 @@ func (q *Queries) GetChirpsByUserID(ctx context.Context, userID uuid.UUID) ([]Ch
 	}
 	return items, nil
 }
+
+const listTimelineDesc = `-- name: ListTimelineDesc :many
+SELECT id, body, created_at, updated_at, user_id, parent_id, reply_count, deleted_at, like_count, rechirp_of_id, quote_of_id, search_vector, hidden_at FROM chirps
+WHERE deleted_at IS NULL AND hidden_at IS NULL
+  AND (user_id = $1
+    OR user_id IN (SELECT followee_id FROM follows WHERE follower_id = $1))
+  AND ($2::timestamp IS NULL
+    OR (created_at, id) > ($2::timestamp, $3::uuid))
+  AND ($4::timestamp IS NULL
+    OR (created_at, id) < ($4::timestamp, $5::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT $6
+`
+
+type ListTimelineDescParams struct {
+	UserID          uuid.UUID
+	AfterCreatedAt  sql.NullTime
+	AfterID         uuid.NullUUID
+	BeforeCreatedAt sql.NullTime
+	BeforeID        uuid.NullUUID
+	PageLimit       int32
+}
+
+func (q *Queries) ListTimelineDesc(ctx context.Context, arg ListTimelineDescParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listTimelineDesc,
+		arg.UserID,
+		arg.AfterCreatedAt,
+		arg.AfterID,
+		arg.BeforeCreatedAt,
+		arg.BeforeID,
+		arg.PageLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.Body,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.ParentID,
+			&i.ReplyCount,
+			&i.DeletedAt,
+			&i.LikeCount,
+			&i.RechirpOfID,
+			&i.QuoteOfID,
+			&i.SearchVector,
+			&i.HiddenAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const lockChirpByID = `-- name: LockChirpByID :one
+SELECT id, body, created_at, updated_at, user_id, parent_id, reply_count, deleted_at, like_count, rechirp_of_id, quote_of_id, search_vector, hidden_at FROM chirps
+WHERE id = $1 AND deleted_at IS NULL AND hidden_at IS NULL
+FOR UPDATE
+`
+
+func (q *Queries) LockChirpByID(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, lockChirpByID, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.Body,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.ParentID,
+		&i.ReplyCount,
+		&i.DeletedAt,
+		&i.LikeCount,
+		&i.RechirpOfID,
+		&i.QuoteOfID,
+		&i.SearchVector,
+		&i.HiddenAt,
+	)
+	return i, err
+}
+
+const restoreUserChirps = `-- name: RestoreUserChirps :exec
+UPDATE chirps
+SET hidden_at = NULL
+FROM users
+WHERE chirps.user_id = users.id
+  AND users.deletion_requested_at IS NULL
+  AND chirps.hidden_at IS NOT NULL
+  AND (chirps.user_id = $1 OR chirps.rechirp_of_id IN (SELECT id FROM chirps WHERE user_id = $1))
+  AND NOT EXISTS (
+    SELECT 1 FROM chirps original
+    JOIN users author ON author.id = original.user_id
+    WHERE original.id = chirps.rechirp_of_id AND author.deletion_requested_at IS NOT NULL
+  )
+`
+
+func (q *Queries) RestoreUserChirps(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, restoreUserChirps, userID)
+	return err
+}
+
+const searchChirps = `-- name: SearchChirps :many
+WITH matches AS (
+    SELECT id, ts_rank(search_vector, websearch_to_tsquery('english', $1::text)) AS rank
+    FROM chirps
+    WHERE search_vector @@ websearch_to_tsquery('english', $1::text)
+      AND deleted_at IS NULL AND hidden_at IS NULL
+      AND ($2::uuid IS NULL OR user_id = $2::uuid)
+)
+SELECT id, rank::real AS rank FROM matches
+WHERE $3::real IS NULL
+   OR (rank, id) < ($3::real, $4::uuid)
+ORDER BY rank DESC, id DESC
+LIMIT $5
+`
+
+type SearchChirpsParams struct {
+	Query     string
+	AuthorID  uuid.NullUUID
+	AfterRank sql.NullFloat64
+	AfterID   uuid.NullUUID
+	PageLimit int32
+}
+
+type SearchChirpsRow struct {
+	ID   uuid.UUID
+	Rank float32
+}
+
+func (q *Queries) SearchChirps(ctx context.Context, arg SearchChirpsParams) ([]SearchChirpsRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchChirps,
+		arg.Query,
+		arg.AuthorID,
+		arg.AfterRank,
+		arg.AfterID,
+		arg.PageLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchChirpsRow
+	for rows.Next() {
+		var i SearchChirpsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Rank,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const tombstoneChirpByID = `-- name: TombstoneChirpByID :exec
+UPDATE chirps
+SET body = '', deleted_at = NOW(), updated_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) TombstoneChirpByID(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, tombstoneChirpByID, id)
+	return err
+}
+
+const updateChirp = `-- name: UpdateChirp :one
+WITH previous AS (
+    INSERT INTO chirp_revisions (id, chirp_id, body, created_at)
+    SELECT gen_random_uuid(), id, body, NOW() FROM chirps
+    WHERE id = $1 AND user_id = $3 AND deleted_at IS NULL AND hidden_at IS NULL
+    FOR UPDATE
+)
+UPDATE chirps
+SET body = $2, updated_at = NOW()
+WHERE id = $1 AND user_id = $3 AND deleted_at IS NULL AND hidden_at IS NULL
+RETURNING id, body, created_at, updated_at, user_id, parent_id, reply_count, deleted_at, like_count, rechirp_of_id, quote_of_id, search_vector, hidden_at
+`
+
+type UpdateChirpParams struct {
+	ID     uuid.UUID
+	Body   string
+	UserID uuid.UUID
+}
+
+func (q *Queries) UpdateChirp(ctx context.Context, arg UpdateChirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, updateChirp, arg.ID, arg.Body, arg.UserID)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.Body,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.ParentID,
+		&i.ReplyCount,
+		&i.DeletedAt,
+		&i.LikeCount,
+		&i.RechirpOfID,
+		&i.QuoteOfID,
+		&i.SearchVector,
+		&i.HiddenAt,
+	)
+	return i, err
+}
@@ -12,27 +12,174 @@ import (
 )
 
 type Chirp struct {
+	ID           uuid.UUID
+	Body         string
+	CreatedAt    sql.NullTime
+	UpdatedAt    sql.NullTime
+	UserID       uuid.UUID
+	ParentID     uuid.NullUUID
+	ReplyCount   int32
+	DeletedAt    sql.NullTime
+	LikeCount    int32
+	RechirpOfID  uuid.NullUUID
+	QuoteOfID    uuid.NullUUID
+	SearchVector interface{}
+	HiddenAt     sql.NullTime
+}
+
+type ChirpHashtag struct {
+	ChirpID   uuid.UUID
+	Tag       string
+	CreatedAt sql.NullTime
+}
+
+type ChirpLike struct {
+	UserID    uuid.UUID
+	ChirpID   uuid.UUID
+	CreatedAt sql.NullTime
+}
+
+type ChirpMention struct {
+	ChirpID   uuid.UUID
+	UserID    uuid.UUID
+	CreatedAt sql.NullTime
+}
+
+type ChirpRevision struct {
 	ID        uuid.UUID
+	ChirpID   uuid.UUID
 	Body      string
 	CreatedAt sql.NullTime
-	UpdatedAt sql.NullTime
+}
+
+type Follow struct {
+	FollowerID uuid.UUID
+	FolloweeID uuid.UUID
+	CreatedAt  sql.NullTime
+}
+
+type LoginChallenge struct {
+	TokenHash string
+	UserID    uuid.UUID
+	Attempts  int32
+	CreatedAt sql.NullTime
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type LoginFailure struct {
+	ID        uuid.UUID
+	Email     string
+	UserID    uuid.NullUUID
+	IpAddress string
+	UserAgent string
+	Reason    string
+	CreatedAt sql.NullTime
+}
+
+type LoginThrottle struct {
+	Subject       string
+	Failures      int32
+	LastFailureAt time.Time
+	BlockedUntil  sql.NullTime
+}
+
+type OauthAuthorizationCode struct {
+	CodeHash      string
+	ClientID      uuid.UUID
+	UserID        uuid.UUID
+	RedirectUri   string
+	Scopes        []string
+	CodeChallenge string
+	CreatedAt     sql.NullTime
+	ExpiresAt     time.Time
+	UsedAt        sql.NullTime
+}
+
+type OauthClient struct {
+	ID           uuid.UUID
+	OwnerID      uuid.UUID
+	Name         string
+	RedirectUris []string
+	SecretHash   sql.NullString
+	CreatedAt    sql.NullTime
+}
+
+type OauthRefreshToken struct {
+	TokenHash string
+	ClientID  uuid.UUID
 	UserID    uuid.UUID
+	Scopes    []string
+	CreatedAt sql.NullTime
+	ExpiresAt time.Time
+	RevokedAt sql.NullTime
+	FamilyID  uuid.UUID
+	RotatedAt sql.NullTime
+}
+
+type PasswordReset struct {
+	TokenHash string
+	UserID    uuid.UUID
+	CreatedAt sql.NullTime
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type PersonalAccessToken struct {
+	ID         uuid.UUID
+	UserID     uuid.UUID
+	Name       string
+	TokenHash  string
+	Scopes     []string
+	CreatedAt  sql.NullTime
+	ExpiresAt  time.Time
+	LastUsedAt sql.NullTime
+	RevokedAt  sql.NullTime
+}
+
+type RecoveryCode struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	CodeHash  string
+	CreatedAt sql.NullTime
+	UsedAt    sql.NullTime
 }
 
 type RefreshToken struct {
-	Token     string
+	TokenHash string
 	CreatedAt sql.NullTime
 	UpdatedAt sql.NullTime
 	UserID    uuid.UUID
 	ExpiresAt time.Time
 	RevokedAt sql.NullTime
+	FamilyID  uuid.UUID
+	RotatedAt sql.NullTime
+}
+
+type Session struct {
+	ID         uuid.UUID
+	UserID     uuid.UUID
+	UserAgent  string
+	IpAddress  string
+	CreatedAt  sql.NullTime
+	LastUsedAt sql.NullTime
 }
 
 type User struct {
-	ID             uuid.UUID
-	Email          string
-	CreatedAt      sql.NullTime
-	UpdatedAt      sql.NullTime
-	HashedPassword string
-	IsChirpyRed    bool
+	ID                  uuid.UUID
+	Email               string
+	CreatedAt           sql.NullTime
+	UpdatedAt           sql.NullTime
+	HashedPassword      string
+	IsChirpyRed         bool
+	Handle              string
+	DisplayName         string
+	Bio                 string
+	AvatarUrl           string
+	TotpSecret          sql.NullString
+	TotpEnabledAt       sql.NullTime
+	TotpLastStep        int64
+	EmailVerifiedAt     sql.NullTime
+	PendingEmail        sql.NullString
+	DeletionRequestedAt sql.NullTime
 }
@@ -7,23 +7,96 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const cancelUserDeletion = `-- name: CancelUserDeletion :one
+UPDATE users
+SET deletion_requested_at = NULL, updated_at = NOW()
+WHERE id = $1 AND deletion_requested_at IS NOT NULL
+RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red, handle, display_name, bio, avatar_url, totp_secret, totp_enabled_at, totp_last_step, email_verified_at, pending_email, deletion_requested_at
+`
+
+func (q *Queries) CancelUserDeletion(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, cancelUserDeletion, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.DeletionRequestedAt,
+	)
+	return i, err
+}
+
+const confirmEmail = `-- name: ConfirmEmail :one
+UPDATE users
+SET email = $1::text,
+    pending_email = CASE WHEN pending_email = $1::text THEN NULL ELSE pending_email END,
+    email_verified_at = CASE WHEN email = $1::text THEN COALESCE(email_verified_at, NOW()) ELSE NOW() END,
+    updated_at = NOW()
+WHERE id = $2 AND (email = $1::text OR pending_email = $1::text)
+RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red, handle, display_name, bio, avatar_url, totp_secret, totp_enabled_at, totp_last_step, email_verified_at, pending_email, deletion_requested_at
+`
+
+type ConfirmEmailParams struct {
+	Email string
+	ID    uuid.UUID
+}
+
+func (q *Queries) ConfirmEmail(ctx context.Context, arg ConfirmEmailParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, confirmEmail, arg.Email, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.DeletionRequestedAt,
+	)
+	return i, err
+}
+
 const createUser = `-- name: CreateUser :one
-INSERT INTO users (id, email, hashed_password, created_at, updated_at)
-VALUES (gen_random_uuid(), $1, $2, NOW(), NOW())
-RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red
+INSERT INTO users (id, email, hashed_password, handle, created_at, updated_at)
+VALUES (gen_random_uuid(), $1, $2, $3, NOW(), NOW())
+RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red, handle, display_name, bio, avatar_url, totp_secret, totp_enabled_at, totp_last_step, email_verified_at, pending_email, deletion_requested_at
 `
 
 type CreateUserParams struct {
 	Email          string
 	HashedPassword string
+	Handle         string
 }
 
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
-	row := q.db.QueryRowContext(ctx, createUser, arg.Email, arg.HashedPassword)
+	row := q.db.QueryRowContext(ctx, createUser, arg.Email, arg.HashedPassword, arg.Handle)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -32,12 +105,22 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.UpdatedAt,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.DeletionRequestedAt,
 	)
 	return i, err
 }
 
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, email, created_at, updated_at, hashed_password, is_chirpy_red FROM users WHERE email = $1
+SELECT id, email, created_at, updated_at, hashed_password, is_chirpy_red, handle, display_name, bio, avatar_url, totp_secret, totp_enabled_at, totp_last_step, email_verified_at, pending_email, deletion_requested_at FROM users WHERE email = $1
 `
 
 func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error) {
@@ -50,12 +133,50 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.UpdatedAt,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.DeletionRequestedAt,
+	)
+	return i, err
+}
+
+const getUserByHandle = `-- name: GetUserByHandle :one
+SELECT id, email, created_at, updated_at, hashed_password, is_chirpy_red, handle, display_name, bio, avatar_url, totp_secret, totp_enabled_at, totp_last_step, email_verified_at, pending_email, deletion_requested_at FROM users WHERE handle = $1
+`
+
+func (q *Queries) GetUserByHandle(ctx context.Context, handle string) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByHandle, handle)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.DeletionRequestedAt,
 	)
 	return i, err
 }
 
 const getUserByID = `-- name: GetUserByID :one
-SELECT id, email, created_at, updated_at, hashed_password, is_chirpy_red FROM users WHERE id = $1
+SELECT id, email, created_at, updated_at, hashed_password, is_chirpy_red, handle, display_name, bio, avatar_url, totp_secret, totp_enabled_at, totp_last_step, email_verified_at, pending_email, deletion_requested_at FROM users WHERE id = $1
 `
 
 func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
@@ -68,12 +189,134 @@ func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
 		&i.UpdatedAt,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.DeletionRequestedAt,
+	)
+	return i, err
+}
+
+const getUserProfileStats = `-- name: GetUserProfileStats :one
+SELECT
+    (SELECT COUNT(*) FROM chirps WHERE chirps.user_id = $1 AND chirps.deleted_at IS NULL AND chirps.hidden_at IS NULL) AS chirp_count,
+    (SELECT COUNT(*) FROM follows WHERE follows.followee_id = $1) AS follower_count,
+    (SELECT COUNT(*) FROM follows WHERE follows.follower_id = $1) AS following_count
+`
+
+type GetUserProfileStatsRow struct {
+	ChirpCount     int64
+	FollowerCount  int64
+	FollowingCount int64
+}
+
+func (q *Queries) GetUserProfileStats(ctx context.Context, userID uuid.UUID) (GetUserProfileStatsRow, error) {
+	row := q.db.QueryRowContext(ctx, getUserProfileStats, userID)
+	var i GetUserProfileStatsRow
+	err := row.Scan(
+		&i.ChirpCount,
+		&i.FollowerCount,
+		&i.FollowingCount,
+	)
+	return i, err
+}
+
+const getUsersByHandles = `-- name: GetUsersByHandles :many
+SELECT id, email, created_at, updated_at, hashed_password, is_chirpy_red, handle, display_name, bio, avatar_url, totp_secret, totp_enabled_at, totp_last_step, email_verified_at, pending_email, deletion_requested_at FROM users WHERE handle = ANY($1::text[])
+`
+
+func (q *Queries) GetUsersByHandles(ctx context.Context, handles []string) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, getUsersByHandles, pq.Array(handles))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.Email,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.HashedPassword,
+			&i.IsChirpyRed,
+			&i.Handle,
+			&i.DisplayName,
+			&i.Bio,
+			&i.AvatarUrl,
+			&i.TotpSecret,
+			&i.TotpEnabledAt,
+			&i.TotpLastStep,
+			&i.EmailVerifiedAt,
+			&i.PendingEmail,
+			&i.DeletionRequestedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const purgeDeletedUsers = `-- name: PurgeDeletedUsers :execrows
+DELETE FROM users
+WHERE deletion_requested_at < NOW() - make_interval(secs => $1::integer)
+`
+
+func (q *Queries) PurgeDeletedUsers(ctx context.Context, graceSeconds int32) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeDeletedUsers, graceSeconds)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const requestUserDeletion = `-- name: RequestUserDeletion :one
+UPDATE users
+SET deletion_requested_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND deletion_requested_at IS NULL
+RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red, handle, display_name, bio, avatar_url, totp_secret, totp_enabled_at, totp_last_step, email_verified_at, pending_email, deletion_requested_at
+`
+
+func (q *Queries) RequestUserDeletion(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, requestUserDeletion, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.DeletionRequestedAt,
 	)
 	return i, err
 }
 
 const resetUsers = `-- name: ResetUsers :exec
-TRUNCATE TABLE users CASCADE
+TRUNCATE TABLE users, login_throttles CASCADE
 `
 
 func (q *Queries) ResetUsers(ctx context.Context) error {
@@ -81,21 +324,86 @@ func (q *Queries) ResetUsers(ctx context.Context) error {
 	return err
 }
 
-const updateUser = `-- name: UpdateUser :one
+const updateUserEmail = `-- name: UpdateUserEmail :one
 UPDATE users
-SET email = $1, updated_at = NOW(), hashed_password = $2
-WHERE id = $3
-RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red
+SET pending_email = CASE WHEN $1::text = email THEN NULL ELSE $1::text END,
+    updated_at = NOW()
+WHERE id = $2
+RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red, handle, display_name, bio, avatar_url, totp_secret, totp_enabled_at, totp_last_step, email_verified_at, pending_email, deletion_requested_at
 `
 
-type UpdateUserParams struct {
-	Email          string
-	HashedPassword string
+type UpdateUserEmailParams struct {
+	Email string
+	ID    uuid.UUID
+}
+
+func (q *Queries) UpdateUserEmail(ctx context.Context, arg UpdateUserEmailParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserEmail, arg.Email, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.DeletionRequestedAt,
+	)
+	return i, err
+}
+
+const updateUserPassword = `-- name: UpdateUserPassword :exec
+UPDATE users
+SET hashed_password = $2, updated_at = NOW()
+WHERE id = $1
+`
+
+type UpdateUserPasswordParams struct {
 	ID             uuid.UUID
+	HashedPassword string
+}
+
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserPassword, arg.ID, arg.HashedPassword)
+	return err
 }
 
-func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error) {
-	row := q.db.QueryRowContext(ctx, updateUser, arg.Email, arg.HashedPassword, arg.ID)
+const updateUserProfile = `-- name: UpdateUserProfile :one
+UPDATE users
+SET handle = COALESCE($1::text, handle),
+    display_name = COALESCE($2::text, display_name),
+    bio = COALESCE($3::text, bio),
+    avatar_url = COALESCE($4::text, avatar_url),
+    updated_at = NOW()
+WHERE id = $5
+RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red, handle, display_name, bio, avatar_url, totp_secret, totp_enabled_at, totp_last_step, email_verified_at, pending_email, deletion_requested_at
+`
+
+type UpdateUserProfileParams struct {
+	Handle      sql.NullString
+	DisplayName sql.NullString
+	Bio         sql.NullString
+	AvatarUrl   sql.NullString
+	ID          uuid.UUID
+}
+
+func (q *Queries) UpdateUserProfile(ctx context.Context, arg UpdateUserProfileParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserProfile,
+		arg.Handle,
+		arg.DisplayName,
+		arg.Bio,
+		arg.AvatarUrl,
+		arg.ID,
+	)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -104,15 +412,42 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, e
 		&i.UpdatedAt,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.DeletionRequestedAt,
 	)
 	return i, err
 }
 
+const upgradeUserPasswordHash = `-- name: UpgradeUserPasswordHash :exec
+UPDATE users
+SET hashed_password = $1
+WHERE id = $2 AND hashed_password = $3
+`
+
+type UpgradeUserPasswordHashParams struct {
+	NewHash string
+	ID      uuid.UUID
+	OldHash string
+}
+
+func (q *Queries) UpgradeUserPasswordHash(ctx context.Context, arg UpgradeUserPasswordHashParams) error {
+	_, err := q.db.ExecContext(ctx, upgradeUserPasswordHash, arg.NewHash, arg.ID, arg.OldHash)
+	return err
+}
+
 const upgradeUserToChirpyRed = `-- name: UpgradeUserToChirpyRed :one
 UPDATE users
 SET is_chirpy_red = TRUE
 WHERE id = $1
-RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red
+RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red, handle, display_name, bio, avatar_url, totp_secret, totp_enabled_at, totp_last_step, email_verified_at, pending_email, deletion_requested_at
 `
 
 func (q *Queries) UpgradeUserToChirpyRed(ctx context.Context, id uuid.UUID) (User, error) {
@@ -125,6 +460,16 @@ func (q *Queries) UpgradeUserToChirpyRed(ctx context.Context, id uuid.UUID) (Use
 		&i.UpdatedAt,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.DeletionRequestedAt,
 	)
 	return i, err
 }
@@ -0,0 +1,32 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers email. The SMTP implementation is meant for production;
+// LogMailer and FileMailer let development and tests run without a mail
+// server.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// validateHeaders rejects line breaks in header values, which would let
+// user-supplied addresses inject extra headers or recipients.
+func validateHeaders(values ...string) error {
+	for _, value := range values {
+		if strings.ContainsAny(value, "\r\n") {
+			return errors.New("mail headers must not contain line breaks")
+		}
+	}
+	return nil
+}
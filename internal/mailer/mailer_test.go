@@ -0,0 +1,114 @@
+package mailer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  []string
+		wantErr bool
+	}{
+		{"plain values", []string{"user@example.com", "Reset your password"}, false},
+		{"no values", nil, false},
+		{"line feed", []string{"user@example.com\nBcc: victim@example.com"}, true},
+		{"carriage return", []string{"user@example.com\rBcc: victim@example.com"}, true},
+		{"CRLF in a later value", []string{"user@example.com", "Hi\r\nBcc: victim@example.com"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateHeaders(tt.values...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestFormatMessage(t *testing.T) {
+	tests := []struct {
+		name        string
+		subject     string
+		wantSubject string
+	}{
+		{"ascii subject", "Reset your Chirpy password", "Subject: Reset your Chirpy password\r\n"},
+		{"non-ascii subject", "Café ☕", "Subject: =?utf-8?q?Caf=C3=A9_=E2=98=95?=\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := string(formatMessage("noreply@chirpy.test", Message{
+				To:      "user@example.com",
+				Subject: tt.subject,
+				Body:    "Hello\n",
+			}))
+
+			headers, body, ok := strings.Cut(raw, "\r\n\r\n")
+			if !ok {
+				t.Fatalf("Expected a blank line between headers and body, got %q", raw)
+			}
+			if body != "Hello\n" {
+				t.Fatalf("Expected body %q, got %q", "Hello\n", body)
+			}
+
+			for _, want := range []string{
+				"From: noreply@chirpy.test\r\n",
+				"To: user@example.com\r\n",
+				tt.wantSubject,
+				"Date: ",
+				"MIME-Version: 1.0\r\n",
+				"Content-Type: text/plain; charset=utf-8",
+			} {
+				if !strings.Contains(headers+"\r\n", want) {
+					t.Errorf("Expected header %q in %q", want, headers)
+				}
+			}
+		})
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	m := FileMailer{Dir: dir, From: "noreply@chirpy.test"}
+
+	err := m.Send(context.Background(), Message{To: "user@example.com", Subject: "Hi", Body: "Hello\n"})
+	if err != nil {
+		t.Fatalf("Failed to send message: %v", err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("Expected one .eml file, got %v (%v)", files, err)
+	}
+
+	info, err := os.Stat(files[0])
+	if err != nil {
+		t.Fatalf("Failed to stat message file: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Fatalf("Expected message file mode 0600, got %o", perm)
+	}
+
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatalf("Failed to read message file: %v", err)
+	}
+	if !strings.Contains(string(data), "To: user@example.com\r\n") {
+		t.Fatalf("Expected the message in the file, got %q", data)
+	}
+
+	err = m.Send(context.Background(), Message{To: "user@example.com\r\nBcc: victim@example.com", Subject: "Hi"})
+	if err == nil {
+		t.Fatal("Expected a recipient with a line break to be rejected")
+	}
+	files, _ = filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) != 1 {
+		t.Fatalf("Expected the rejected message not to be written, got %v", files)
+	}
+}
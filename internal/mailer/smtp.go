@@ -0,0 +1,62 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"time"
+)
+
+// SMTPMailer sends mail through an SMTP relay. net/smtp upgrades the
+// connection with STARTTLS whenever the server offers it.
+type SMTPMailer struct {
+	Addr string
+	From string
+	Auth smtp.Auth
+}
+
+// NewSMTPMailer returns a mailer for the relay at host:port. Authentication
+// is skipped when username is empty.
+func NewSMTPMailer(host, port, username, password, from string) *SMTPMailer {
+	m := &SMTPMailer{
+		Addr: net.JoinHostPort(host, port),
+		From: from,
+	}
+	if username != "" {
+		m.Auth = smtp.PlainAuth("", username, password, host)
+	}
+	return m
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	err := validateHeaders(msg.To, msg.Subject, m.From)
+	if err != nil {
+		return err
+	}
+
+	// net/smtp has no context support, so the best we can do is not start
+	// a send for a request that has already gone away.
+	err = ctx.Err()
+	if err != nil {
+		return err
+	}
+
+	return smtp.SendMail(m.Addr, m.Auth, m.From, []string{msg.To}, formatMessage(m.From, msg))
+}
+
+// formatMessage renders msg as an RFC 5322 message.
+func formatMessage(from string, msg Message) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(msg.Body)
+	return buf.Bytes()
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/TheJa750/Chirpy/internal/auth"
+	"github.com/TheJa750/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// optionalUserID returns the caller's user ID on endpoints that work without
+// authentication but can personalise their response when a valid access token
+// is supplied.
+func (a *apiConfig) optionalUserID(req *http.Request) (uuid.UUID, bool) {
+	userID, err := a.authenticate(req, auth.ScopeChirpsRead)
+	if err != nil {
+		return uuid.Nil, false
+	}
+
+	return userID, true
+}
+
+// setLikedByMe fills in LikedByMe on each chirp for the given user.
+func (a *apiConfig) setLikedByMe(ctx context.Context, userID uuid.UUID, chirps []*Chirp) error {
+	if len(chirps) == 0 {
+		return nil
+	}
+
+	ids := make([]uuid.UUID, len(chirps))
+	for i, chirp := range chirps {
+		ids[i] = chirp.ID
+	}
+
+	likedIDs, err := a.dbQueries.GetLikedChirpIDs(ctx, database.GetLikedChirpIDsParams{
+		UserID:   userID,
+		ChirpIds: ids,
+	})
+	if err != nil {
+		return err
+	}
+
+	liked := make(map[uuid.UUID]bool, len(likedIDs))
+	for _, id := range likedIDs {
+		liked[id] = true
+	}
+
+	for _, chirp := range chirps {
+		likedByMe := liked[chirp.ID]
+		chirp.LikedByMe = &likedByMe
+	}
+
+	return nil
+}
+
+func (a *apiConfig) likeChirpHandler(w http.ResponseWriter, req *http.Request) {
+	chirpIDstr := req.PathValue("chirpID")
+	chirpID, err := uuid.Parse(chirpIDstr)
+	if err != nil {
+		log.Printf("Invalid chirp ID: %s", err)
+		http.Error(w, "Invalid chirp ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := a.authenticate(req, auth.ScopeChirpsWrite)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		respondAuthError(w, err)
+		return
+	}
+
+	_, err = a.dbQueries.GetChirpByID(req.Context(), chirpID)
+	if err != nil {
+		log.Printf("Error getting chirp by ID: %s", err)
+		http.Error(w, "Chirp not found", http.StatusNotFound)
+		return
+	}
+
+	err = a.dbQueries.LikeChirp(req.Context(), database.LikeChirpParams{
+		UserID:  userID,
+		ChirpID: chirpID,
+	})
+	if err != nil {
+		log.Printf("Error liking chirp: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *apiConfig) unlikeChirpHandler(w http.ResponseWriter, req *http.Request) {
+	chirpIDstr := req.PathValue("chirpID")
+	chirpID, err := uuid.Parse(chirpIDstr)
+	if err != nil {
+		log.Printf("Invalid chirp ID: %s", err)
+		http.Error(w, "Invalid chirp ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := a.authenticate(req, auth.ScopeChirpsWrite)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		respondAuthError(w, err)
+		return
+	}
+
+	err = a.dbQueries.UnlikeChirp(req.Context(), database.UnlikeChirpParams{
+		UserID:  userID,
+		ChirpID: chirpID,
+	})
+	if err != nil {
+		log.Printf("Error unliking chirp: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getUserLikesHandler lists the chirps a user has liked, most recent like first.
+func (a *apiConfig) getUserLikesHandler(w http.ResponseWriter, req *http.Request) {
+	userIDstr := req.PathValue("userID")
+	userID, err := uuid.Parse(userIDstr)
+	if err != nil {
+		log.Printf("Invalid user ID: %s", err)
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	page, err := parseNewestFirstPage(req.URL.Query())
+	if err != nil {
+		log.Printf("Invalid pagination parameters: %s", err)
+		http.Error(w, "Invalid pagination parameters", http.StatusBadRequest)
+		return
+	}
+
+	likes, err := a.dbQueries.ListUserLikes(req.Context(), database.ListUserLikesParams{
+		UserID:          userID,
+		AfterCreatedAt:  page.AfterCreatedAt,
+		AfterID:         page.AfterID,
+		BeforeCreatedAt: page.BeforeCreatedAt,
+		BeforeID:        page.BeforeID,
+		PageLimit:       page.Limit + 1,
+	})
+	if err != nil {
+		log.Printf("Error getting user likes: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	var nextCursor string
+	if len(likes) > int(page.Limit) {
+		likes = likes[:page.Limit]
+		last := likes[len(likes)-1]
+		nextCursor = page.nextCursor(last.CreatedAt.Time, last.ChirpID)
+	}
+
+	ids := make([]uuid.UUID, len(likes))
+	for i, like := range likes {
+		ids[i] = like.ChirpID
+	}
+
+	chirps, err := a.dbQueries.GetChirpsByIDs(req.Context(), ids)
+	if err != nil {
+		log.Printf("Error getting liked chirps: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	byID := make(map[uuid.UUID]database.Chirp, len(chirps))
+	for _, chirp := range chirps {
+		byID[chirp.ID] = chirp
+	}
+
+	// Keep the order of the likes; chirps deleted since they were liked are
+	// skipped.
+	jsonChirps := make([]Chirp, 0, len(likes))
+	for _, like := range likes {
+		if chirp, ok := byID[like.ChirpID]; ok {
+			jsonChirps = append(jsonChirps, chirpFromDB(chirp))
+		}
+	}
+
+	err = a.prepareChirps(req, chirpPointers(jsonChirps))
+	if err != nil {
+		log.Printf("Error preparing chirps: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(ChirpPage{
+		Chirps:     jsonChirps,
+		NextCursor: nextCursor,
+	})
+}
+
+func chirpPointers(chirps []Chirp) []*Chirp {
+	pointers := make([]*Chirp, len(chirps))
+	for i := range chirps {
+		pointers[i] = &chirps[i]
+	}
+	return pointers
+}
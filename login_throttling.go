@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/TheJa750/Chirpy/internal/auth"
+	"github.com/TheJa750/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// Reasons recorded in the login failure audit trail.
+const (
+	loginFailureUnknownEmail  = "unknown_email"
+	loginFailureWrongPassword = "wrong_password"
+	loginFailureWrongCode     = "wrong_code"
+	loginFailureThrottled     = "throttled"
+)
+
+func emailThrottleSubject(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipThrottleSubject(ip string) string {
+	return "ip:" + ip
+}
+
+// reserveAttempt counts an attempt against subject before it is made and
+// returns zero, or, if subject is blocked, how long to wait, in which case
+// nothing is counted. Counting up front in a single statement means
+// concurrent guesses each see the ones before them, so they can't slip past
+// the backoff together.
+func (a *apiConfig) reserveAttempt(ctx context.Context, subject string, throttle auth.LoginThrottle) (time.Duration, error) {
+	_, err := a.dbQueries.ReserveLoginAttempt(ctx, database.ReserveLoginAttemptParams{
+		Subject:       subject,
+		DelaySeconds:  throttle.Schedule(),
+		WindowSeconds: int32(throttle.Window / time.Second),
+	})
+	if err == nil {
+		return 0, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+
+	seconds, err := a.dbQueries.GetLoginRetryAfter(ctx, []string{subject})
+	if err != nil {
+		return 0, err
+	}
+	// The block can run out between the two queries; still ask the client to
+	// back off briefly rather than report a zero wait.
+	return max(time.Duration(seconds)*time.Second, time.Second), nil
+}
+
+// releaseAttempt gives back an attempt reserved against subject that turned
+// out not to be a failure, along with any delay the reservation imposed.
+func (a *apiConfig) releaseAttempt(ctx context.Context, subject string) {
+	err := a.dbQueries.ReleaseLoginAttempt(ctx, subject)
+	if err != nil {
+		log.Printf("Error releasing login attempt: %s", err)
+	}
+}
+
+// startLoginAttempt must be called before any password or authentication
+// code for email is checked. It reserves the attempt against both the email
+// and the client IP, and returns false after writing a 429 (or 500) if
+// either is blocked. The attempt stays counted as a failure unless
+// loginSucceeded is called.
+func (a *apiConfig) startLoginAttempt(w http.ResponseWriter, req *http.Request, email string) bool {
+	ipSubject := ipThrottleSubject(clientIP(req))
+
+	retryAfter, err := a.reserveAttempt(req.Context(), ipSubject, a.IPThrottle)
+	if err == nil && retryAfter == 0 {
+		retryAfter, err = a.reserveAttempt(req.Context(), emailThrottleSubject(email), a.EmailThrottle)
+		if err != nil || retryAfter > 0 {
+			// The attempt isn't going ahead, so the IP shouldn't pay for it.
+			a.releaseAttempt(req.Context(), ipSubject)
+		}
+	}
+	if err != nil {
+		log.Printf("Error checking login throttle: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return false
+	}
+	if retryAfter > 0 {
+		a.recordLoginFailure(req, email, uuid.NullUUID{}, loginFailureThrottled)
+		w.Header().Set("Retry-After", fmt.Sprint(int(retryAfter/time.Second)))
+		http.Error(w, "Too many failed login attempts, try again later", http.StatusTooManyRequests)
+		return false
+	}
+	return true
+}
+
+// recordLoginFailure adds a rejected attempt to the audit trail. The attempt
+// itself was already counted by startLoginAttempt. Errors are logged rather
+// than returned so a database problem never turns a failed login into a
+// successful one.
+func (a *apiConfig) recordLoginFailure(req *http.Request, email string, userID uuid.NullUUID, reason string) {
+	err := a.dbQueries.CreateLoginFailure(req.Context(), database.CreateLoginFailureParams{
+		Email:     email,
+		UserID:    userID,
+		IpAddress: clientIP(req),
+		UserAgent: req.UserAgent(),
+		Reason:    reason,
+	})
+	if err != nil {
+		log.Printf("Error recording login failure: %s", err)
+	}
+}
+
+// loginSucceeded is called once every factor has been checked. It forgets
+// the failures against email and gives back the attempt reserved against the
+// client IP; earlier failures from the IP stay counted, so one known
+// password can't be used to reset its counter.
+func (a *apiConfig) loginSucceeded(req *http.Request, email string) {
+	a.clearLoginFailures(req.Context(), email)
+	a.releaseAttempt(req.Context(), ipThrottleSubject(clientIP(req)))
+}
+
+// abandonLoginAttempt gives back both attempts reserved by startLoginAttempt
+// when nothing was actually checked, such as when the client left out a
+// required authentication code.
+func (a *apiConfig) abandonLoginAttempt(req *http.Request, email string) {
+	a.releaseAttempt(req.Context(), emailThrottleSubject(email))
+	a.releaseAttempt(req.Context(), ipThrottleSubject(clientIP(req)))
+}
+
+// clearLoginFailures forgets failed attempts against email.
+func (a *apiConfig) clearLoginFailures(ctx context.Context, email string) {
+	err := a.dbQueries.ClearLoginThrottle(ctx, emailThrottleSubject(email))
+	if err != nil {
+		log.Printf("Error clearing login failures: %s", err)
+	}
+}
@@ -1,13 +1,21 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"sync/atomic"
+	"time"
 
+	"github.com/TheJa750/Chirpy/internal/auth"
 	"github.com/TheJa750/Chirpy/internal/database"
+	"github.com/TheJa750/Chirpy/internal/mailer"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq" // Importing pq for PostgreSQL driver
 )
@@ -21,6 +29,36 @@ func main() {
 		log.Fatalf("Error connecting to the database: %s", err)
 	}
 
+	jwtKeys, err := loadKeyring()
+	if err != nil {
+		log.Fatalf("Error loading JWT signing keys: %s", err)
+	}
+
+	passwords, err := loadPasswordHasher()
+	if err != nil {
+		log.Fatalf("Error loading password hashing parameters: %s", err)
+	}
+
+	passwordPolicy, err := loadPasswordPolicy()
+	if err != nil {
+		log.Fatalf("Error loading password policy: %s", err)
+	}
+
+	deletionGracePeriod, err := loadDeletionGracePeriod()
+	if err != nil {
+		log.Fatalf("Error loading account deletion grace period: %s", err)
+	}
+
+	jwtAudience := os.Getenv("JWT_AUDIENCE")
+	if jwtAudience == "" {
+		jwtAudience = "chirpy"
+	}
+
+	baseURL := strings.TrimSuffix(os.Getenv("PUBLIC_URL"), "/")
+	if baseURL == "" {
+		baseURL = "http://localhost:8080"
+	}
+
 	mux := http.NewServeMux()
 
 	svr := http.Server{
@@ -30,9 +68,27 @@ func main() {
 
 	cfg := apiConfig{
 		fileserverHits: atomic.Int32{},
+		db:             db,
 		dbQueries:      database.New(db),
-		JWTSecret:      os.Getenv("SECRET"),
+		JWT: auth.JWTConfig{
+			Keys:     jwtKeys,
+			Issuer:   "chirpy",
+			Audience: jwtAudience,
+			Leeway:   30 * time.Second,
+		},
+		Passwords:      passwords,
+		PasswordPolicy: passwordPolicy,
 		PolkaKey:       os.Getenv("POLKA_KEY"),
+		Mailer:         loadMailer(),
+		BaseURL:        baseURL,
+		// Accounts are read-only until their email is verified unless
+		// UNVERIFIED_ACCOUNTS is "full".
+		ReadOnlyUntilVerified: os.Getenv("UNVERIFIED_ACCOUNTS") != "full",
+		EmailThrottle:         auth.DefaultEmailThrottle,
+		IPThrottle:            auth.DefaultIPThrottle,
+		ResetEmailThrottle:    auth.DefaultResetEmailThrottle,
+		ResetIPThrottle:       auth.DefaultResetIPThrottle,
+		DeletionGracePeriod:   deletionGracePeriod,
 	}
 
 	fileHandler := http.StripPrefix("/app/", http.FileServer(http.Dir(".")))
@@ -47,12 +103,59 @@ func main() {
 	mux.HandleFunc("POST /api/users", cfg.createUserHandler)
 	mux.HandleFunc("POST /api/chirps", cfg.postChirpHandler)
 	mux.HandleFunc("GET /api/chirps", cfg.getChirpsHandler)
+	mux.HandleFunc("GET /api/chirps/search", cfg.searchChirpsHandler)
 	mux.HandleFunc("GET /api/chirps/{chirpID}", cfg.getChirpByIDHandler)
 	mux.HandleFunc("POST /api/login", cfg.loginUserHandler)
+	mux.HandleFunc("POST /api/login/2fa", cfg.loginTwoFactorHandler)
+	mux.HandleFunc("POST /api/password-reset/request", cfg.requestPasswordResetHandler)
+	mux.HandleFunc("POST /api/password-reset/confirm", cfg.confirmPasswordResetHandler)
+	mux.HandleFunc("GET /api/verify-email", cfg.verifyEmailHandler)
+	mux.HandleFunc("POST /api/verify-email/resend", cfg.resendVerificationHandler)
 	mux.HandleFunc("POST /api/refresh", cfg.refreshHandler)
 	mux.HandleFunc("POST /api/revoke", cfg.revokeRefreshTokenHandler)
+	mux.HandleFunc("PATCH /api/users", cfg.updateUserHandler)
+	// PUT is kept for older clients; it has the same partial semantics.
 	mux.HandleFunc("PUT /api/users", cfg.updateUserHandler)
+	mux.HandleFunc("POST /api/reauthenticate", cfg.reauthenticateHandler)
+	mux.HandleFunc("DELETE /api/users", cfg.deleteUserHandler)
+	mux.HandleFunc("POST /api/users/cancel-deletion", cfg.cancelDeletionHandler)
 	mux.HandleFunc("DELETE /api/chirps/{chirpID}", cfg.deleteChirpHandler)
+	mux.HandleFunc("PUT /api/chirps/{chirpID}", cfg.updateChirpHandler)
+	mux.HandleFunc("GET /api/chirps/{chirpID}/revisions", cfg.getChirpRevisionsHandler)
+	mux.HandleFunc("GET /api/chirps/{chirpID}/thread", cfg.getChirpThreadHandler)
+	mux.HandleFunc("POST /api/users/{userID}/follow", cfg.followUserHandler)
+	mux.HandleFunc("DELETE /api/users/{userID}/follow", cfg.unfollowUserHandler)
+	mux.HandleFunc("GET /api/users/{userID}/followers", cfg.getFollowersHandler)
+	mux.HandleFunc("GET /api/users/{userID}/following", cfg.getFollowingHandler)
+	mux.HandleFunc("GET /api/timeline", cfg.getTimelineHandler)
+	mux.HandleFunc("POST /api/chirps/{chirpID}/like", cfg.likeChirpHandler)
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}/like", cfg.unlikeChirpHandler)
+	mux.HandleFunc("GET /api/users/{userID}/likes", cfg.getUserLikesHandler)
+	mux.HandleFunc("POST /api/chirps/{chirpID}/rechirp", cfg.rechirpHandler)
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}/rechirp", cfg.undoRechirpHandler)
+	mux.HandleFunc("GET /api/hashtags/trending", cfg.getTrendingHashtagsHandler)
+	mux.HandleFunc("GET /api/hashtags/{tag}/chirps", cfg.getHashtagChirpsHandler)
+	mux.HandleFunc("GET /api/users/me/mentions", cfg.getMyMentionsHandler)
+	mux.HandleFunc("PATCH /api/users/me", cfg.updateProfileHandler)
+	mux.HandleFunc("GET /api/users/{handle}", cfg.getUserProfileHandler)
+	mux.HandleFunc("GET /api/sessions", cfg.listSessionsHandler)
+	mux.HandleFunc("DELETE /api/sessions/{sessionID}", cfg.revokeSessionHandler)
+	mux.HandleFunc("POST /api/logout-all", cfg.logoutAllHandler)
+	mux.HandleFunc("GET /.well-known/jwks.json", cfg.jwksHandler)
+	mux.HandleFunc("POST /api/tokens", cfg.createPersonalTokenHandler)
+	mux.HandleFunc("GET /api/tokens", cfg.listPersonalTokensHandler)
+	mux.HandleFunc("DELETE /api/tokens/{tokenID}", cfg.revokePersonalTokenHandler)
+	mux.HandleFunc("POST /api/oauth/clients", cfg.createOAuthClientHandler)
+	mux.HandleFunc("GET /api/oauth/clients", cfg.listOAuthClientsHandler)
+	mux.HandleFunc("DELETE /api/oauth/clients/{clientID}", cfg.deleteOAuthClientHandler)
+	mux.HandleFunc("GET /oauth/authorize", cfg.authorizeHandler)
+	mux.HandleFunc("POST /oauth/authorize", cfg.approveAuthorizationHandler)
+	mux.HandleFunc("POST /oauth/token", cfg.oauthTokenHandler)
+	mux.HandleFunc("POST /oauth/revoke", cfg.oauthRevokeHandler)
+	mux.HandleFunc("POST /api/users/me/2fa", cfg.enrollTwoFactorHandler)
+	mux.HandleFunc("POST /api/users/me/2fa/confirm", cfg.confirmTwoFactorHandler)
+	mux.HandleFunc("POST /api/users/me/2fa/recovery-codes", cfg.regenerateRecoveryCodesHandler)
+	mux.HandleFunc("DELETE /api/users/me/2fa", cfg.disableTwoFactorHandler)
 
 	//webhook handlers
 	mux.HandleFunc("POST /api/polka/webhooks", cfg.upgradeUserHandler)
@@ -60,6 +163,174 @@ func main() {
 	//dev handlers
 	mux.HandleFunc("POST /admin/reset", cfg.resetUsersHandler)
 
+	go cfg.purgeDeletedAccounts(context.Background(), time.Hour)
+
 	svr.ListenAndServe()
 
 }
+
+// loadKeyring builds the access token keyring from the environment.
+// JWT_SIGNING_KEY is the private key new tokens are signed with; it is
+// generated with JWT_SIGNING_ALG (EdDSA or RS256) if the file doesn't exist.
+// JWT_VERIFICATION_KEYS is a comma separated list of retired key files whose
+// tokens are still accepted.
+func loadKeyring() (*auth.Keyring, error) {
+	signingKeyPath := os.Getenv("JWT_SIGNING_KEY")
+	if signingKeyPath == "" {
+		signingKeyPath = "keys/jwt_signing_key.pem"
+	}
+
+	alg := os.Getenv("JWT_SIGNING_ALG")
+	if alg == "" {
+		alg = auth.AlgEdDSA
+	}
+
+	active, err := auth.LoadOrCreateSigningKey(signingKeyPath, alg)
+	if err != nil {
+		return nil, err
+	}
+
+	var verification []*auth.SigningKey
+	for _, path := range strings.Split(os.Getenv("JWT_VERIFICATION_KEYS"), ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		key, err := auth.LoadSigningKey(path)
+		if err != nil {
+			return nil, err
+		}
+		verification = append(verification, key)
+	}
+
+	return auth.NewKeyring(active, verification...)
+}
+
+// loadPasswordHasher builds the argon2id hasher new password hashes are made
+// with. ARGON2_MEMORY_KIB, ARGON2_ITERATIONS and ARGON2_PARALLELISM override
+// the defaults; existing hashes are upgraded to the new parameters the next
+// time their owner logs in.
+func loadPasswordHasher() (auth.PasswordHasher, error) {
+	params := auth.DefaultArgon2Params
+
+	overrides := []struct {
+		name string
+		bits int
+		set  func(uint64)
+	}{
+		{"ARGON2_MEMORY_KIB", 32, func(v uint64) { params.Memory = uint32(v) }},
+		{"ARGON2_ITERATIONS", 32, func(v uint64) { params.Iterations = uint32(v) }},
+		{"ARGON2_PARALLELISM", 8, func(v uint64) { params.Parallelism = uint8(v) }},
+	}
+	for _, o := range overrides {
+		raw := os.Getenv(o.name)
+		if raw == "" {
+			continue
+		}
+		v, err := strconv.ParseUint(raw, 10, o.bits)
+		if err != nil || v == 0 {
+			return nil, fmt.Errorf("%s must be a positive integer", o.name)
+		}
+		o.set(v)
+	}
+
+	limit := auth.MaxArgon2Params
+	if params.Memory > limit.Memory || params.Iterations > limit.Iterations || params.Parallelism > limit.Parallelism {
+		return nil, fmt.Errorf("argon2 parameters can be at most m=%d, t=%d, p=%d", limit.Memory, limit.Iterations, limit.Parallelism)
+	}
+
+	// argon2 needs at least 8 KiB of memory per lane.
+	if params.Memory < 8*uint32(params.Parallelism) {
+		return nil, fmt.Errorf("ARGON2_MEMORY_KIB must be at least %d", 8*uint32(params.Parallelism))
+	}
+
+	return auth.Argon2idHasher{Params: params}, nil
+}
+
+// loadPasswordPolicy builds the policy new passwords are checked against.
+// PASSWORD_MIN_LENGTH and PASSWORD_MAX_LENGTH default to 8 and 128
+// characters. PASSWORD_BLOCKLIST names a file of extra passwords to reject on
+// top of the bundled common password list.
+func loadPasswordPolicy() (*auth.PasswordPolicy, error) {
+	minLength, maxLength := 8, 128
+
+	for name, target := range map[string]*int{
+		"PASSWORD_MIN_LENGTH": &minLength,
+		"PASSWORD_MAX_LENGTH": &maxLength,
+	} {
+		raw := os.Getenv(name)
+		if raw == "" {
+			continue
+		}
+		v, err := strconv.Atoi(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be an integer", name)
+		}
+		*target = v
+	}
+
+	path := os.Getenv("PASSWORD_BLOCKLIST")
+	if path == "" {
+		return auth.NewPasswordPolicy(minLength, maxLength)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return auth.NewPasswordPolicy(minLength, maxLength, f)
+}
+
+// loadDeletionGracePeriod reads ACCOUNT_DELETION_GRACE_PERIOD, a Go
+// duration such as "720h", which defaults to 30 days.
+func loadDeletionGracePeriod() (time.Duration, error) {
+	raw := os.Getenv("ACCOUNT_DELETION_GRACE_PERIOD")
+	if raw == "" {
+		return 30 * 24 * time.Hour, nil
+	}
+
+	grace, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, err
+	}
+	// The purge query takes the period in whole seconds as a 32-bit integer.
+	if grace < time.Second || grace/time.Second > math.MaxInt32 {
+		return 0, fmt.Errorf("ACCOUNT_DELETION_GRACE_PERIOD must be between 1s and %d seconds", math.MaxInt32)
+	}
+	return grace, nil
+}
+
+// loadMailer picks how outgoing mail is delivered from MAILER: "smtp" relays
+// through SMTP_HOST, "file" saves messages in MAIL_DIR, and anything else
+// writes them to the log.
+func loadMailer() mailer.Mailer {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "Chirpy <no-reply@chirpy.local>"
+	}
+
+	switch os.Getenv("MAILER") {
+	case "smtp":
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		return mailer.NewSMTPMailer(
+			os.Getenv("SMTP_HOST"),
+			port,
+			os.Getenv("SMTP_USERNAME"),
+			os.Getenv("SMTP_PASSWORD"),
+			from,
+		)
+	case "file":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "mail"
+		}
+		return mailer.FileMailer{Dir: dir, From: from}
+	default:
+		return mailer.LogMailer{}
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/TheJa750/Chirpy/internal/auth"
+	"github.com/TheJa750/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+var mentionPattern = regexp.MustCompile(`(?:^|\s)@([A-Za-z0-9_]+)`)
+
+// extractMentions returns the distinct, lower-cased handles mentioned in a
+// chirp body.
+func extractMentions(body string) []string {
+	seen := map[string]bool{}
+	handles := []string{}
+	for _, match := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		handle := strings.ToLower(match[1])
+		if !seen[handle] {
+			seen[handle] = true
+			handles = append(handles, handle)
+		}
+	}
+	return handles
+}
+
+// saveChirpMentions replaces the mentions stored for a chirp with the ones
+// found in its body. Handles that don't belong to anyone are left as plain
+// text. q is passed in so the mentions are written in the same transaction
+// as the chirp.
+func saveChirpMentions(ctx context.Context, q *database.Queries, chirpID uuid.UUID, body string) error {
+	err := q.DeleteChirpMentions(ctx, chirpID)
+	if err != nil {
+		return err
+	}
+
+	handles := extractMentions(body)
+	if len(handles) == 0 {
+		return nil
+	}
+
+	users, err := q.GetUsersByHandles(ctx, handles)
+	if err != nil {
+		return err
+	}
+	if len(users) == 0 {
+		return nil
+	}
+
+	userIDs := make([]uuid.UUID, len(users))
+	for i, user := range users {
+		userIDs[i] = user.ID
+	}
+
+	return q.CreateChirpMentions(ctx, database.CreateChirpMentionsParams{
+		ChirpID: chirpID,
+		UserIds: userIDs,
+	})
+}
+
+// getMyMentionsHandler lists the chirps that mention the caller, newest first.
+func (a *apiConfig) getMyMentionsHandler(w http.ResponseWriter, req *http.Request) {
+	userID, err := a.authenticate(req, auth.ScopeChirpsRead)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		respondAuthError(w, err)
+		return
+	}
+
+	page, err := parseNewestFirstPage(req.URL.Query())
+	if err != nil {
+		log.Printf("Invalid pagination parameters: %s", err)
+		http.Error(w, "Invalid pagination parameters", http.StatusBadRequest)
+		return
+	}
+
+	chirps, err := a.dbQueries.ListMentionChirps(req.Context(), database.ListMentionChirpsParams{
+		UserID:          userID,
+		AfterCreatedAt:  page.AfterCreatedAt,
+		AfterID:         page.AfterID,
+		BeforeCreatedAt: page.BeforeCreatedAt,
+		BeforeID:        page.BeforeID,
+		PageLimit:       page.Limit + 1,
+	})
+	if err != nil {
+		log.Printf("Error getting mentions: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	var nextCursor string
+	if len(chirps) > int(page.Limit) {
+		chirps = chirps[:page.Limit]
+		last := chirps[len(chirps)-1]
+		nextCursor = page.nextCursor(last.CreatedAt.Time, last.ID)
+	}
+
+	jsonChirps := make([]Chirp, len(chirps))
+	for i, chirp := range chirps {
+		jsonChirps[i] = chirpFromDB(chirp)
+	}
+
+	err = a.prepareChirps(req, chirpPointers(jsonChirps))
+	if err != nil {
+		log.Printf("Error preparing chirps: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(ChirpPage{
+		Chirps:     jsonChirps,
+		NextCursor: nextCursor,
+	})
+}
@@ -0,0 +1,689 @@
+package main
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/TheJa750/Chirpy/internal/auth"
+	"github.com/TheJa750/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	maxOAuthClientName   = 100
+	maxOAuthRedirectURIs = 10
+	oauthAccessTokenTTL  = 3600 * time.Second
+)
+
+var consentTemplate = template.Must(template.New("consent").Parse(`<html>
+  <body>
+    <h1>Authorize {{.ClientName}}</h1>
+    {{if .Error}}<p><strong>{{.Error}}</strong></p>{{end}}
+    <p>{{.ClientName}} would like to:</p>
+    <ul>
+      {{range .Scopes}}<li>{{.}}</li>{{end}}
+    </ul>
+    <form method="POST" action="/oauth/authorize">
+      <input type="hidden" name="response_type" value="code">
+      <input type="hidden" name="client_id" value="{{.ClientID}}">
+      <input type="hidden" name="redirect_uri" value="{{.RedirectURI}}">
+      <input type="hidden" name="scope" value="{{.Scope}}">
+      <input type="hidden" name="state" value="{{.State}}">
+      <input type="hidden" name="code_challenge" value="{{.CodeChallenge}}">
+      <input type="hidden" name="code_challenge_method" value="S256">
+      <p><label>Email <input type="email" name="email" value="{{.Email}}"></label></p>
+      <p><label>Password <input type="password" name="password"></label></p>
+      <p><label>Authentication code, if two-factor authentication is on <input type="text" name="code" autocomplete="one-time-code"></label></p>
+      <button type="submit" name="decision" value="approve">Allow</button>
+      <button type="submit" name="decision" value="deny">Deny</button>
+    </form>
+  </body>
+</html>`))
+
+type consentPage struct {
+	ClientName    string
+	ClientID      uuid.UUID
+	RedirectURI   string
+	Scope         string
+	Scopes        []string
+	State         string
+	CodeChallenge string
+	Email         string
+	Error         string
+}
+
+// authorizationRequest is a validated /oauth/authorize request.
+type authorizationRequest struct {
+	Client        database.OauthClient
+	RedirectURI   string
+	Scopes        []string
+	State         string
+	CodeChallenge string
+}
+
+// authorizeError is a problem with an authorization request. Until the client
+// and redirect URI are known to be genuine the user is shown the error, since
+// redirecting would make Chirpy an open redirector; afterwards the error is
+// sent back to the client.
+type authorizeError struct {
+	Code        string
+	Description string
+	Redirect    bool
+}
+
+func (e *authorizeError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+// validateRedirectURI accepts https URLs, http URLs on the loopback interface
+// for local development and native apps, and private-use schemes for mobile
+// apps. Private-use schemes must be in reverse domain name form, as RFC 8252
+// section 7.1 asks, which also rules out schemes such as javascript: and
+// data: that a browser would run or render instead of handing to an app.
+func validateRedirectURI(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme == "" {
+		return errors.New("redirect URIs must be absolute")
+	}
+	if u.Fragment != "" {
+		return errors.New("redirect URIs must not contain a fragment")
+	}
+	switch u.Scheme {
+	case "https":
+		if u.Host == "" {
+			return errors.New("redirect URIs must have a host")
+		}
+	case "http":
+		ip := net.ParseIP(u.Hostname())
+		if u.Hostname() != "localhost" && (ip == nil || !ip.IsLoopback()) {
+			return errors.New("http redirect URIs are only allowed for localhost")
+		}
+	default:
+		if !strings.Contains(u.Scheme, ".") {
+			return errors.New("custom redirect URI schemes must be a reverse domain name, such as com.example.app")
+		}
+	}
+	return nil
+}
+
+func oauthClientFromDB(client database.OauthClient) OAuthClient {
+	return OAuthClient{
+		ClientID:     client.ID,
+		Name:         client.Name,
+		RedirectURIs: client.RedirectUris,
+		Confidential: client.SecretHash.Valid,
+		CreatedAt:    client.CreatedAt.Time,
+	}
+}
+
+func (a *apiConfig) createOAuthClientHandler(w http.ResponseWriter, req *http.Request) {
+	decoder := json.NewDecoder(req.Body)
+	clientReq := OAuthClientRequest{}
+	err := decoder.Decode(&clientReq)
+	if err != nil {
+		log.Printf("Error decoding client request: %s", err)
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	user, err := a.authenticateSession(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		respondAuthError(w, err)
+		return
+	}
+
+	name := strings.TrimSpace(clientReq.Name)
+	if name == "" || len(name) > maxOAuthClientName {
+		http.Error(w, "Client name must be between 1 and 100 characters", http.StatusBadRequest)
+		return
+	}
+
+	if len(clientReq.RedirectURIs) == 0 || len(clientReq.RedirectURIs) > maxOAuthRedirectURIs {
+		http.Error(w, "Clients need between 1 and 10 redirect URIs", http.StatusBadRequest)
+		return
+	}
+	for _, redirectURI := range clientReq.RedirectURIs {
+		err = validateRedirectURI(redirectURI)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var secret string
+	var secretHash sql.NullString
+	if clientReq.Confidential {
+		secret, err = auth.MakeRefreshToken()
+		if err != nil {
+			log.Printf("Error creating client secret: %s", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		secretHash = sql.NullString{String: auth.HashRefreshToken(secret), Valid: true}
+	}
+
+	client, err := a.dbQueries.CreateOAuthClient(req.Context(), database.CreateOAuthClientParams{
+		OwnerID:      user.ID,
+		Name:         name,
+		RedirectUris: clientReq.RedirectURIs,
+		SecretHash:   secretHash,
+	})
+	if err != nil {
+		log.Printf("Error creating OAuth client: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Like personal access tokens, the secret is only shown once.
+	jsonClient := oauthClientFromDB(client)
+	jsonClient.ClientSecret = secret
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(jsonClient)
+}
+
+func (a *apiConfig) listOAuthClientsHandler(w http.ResponseWriter, req *http.Request) {
+	user, err := a.authenticateSession(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		respondAuthError(w, err)
+		return
+	}
+
+	clients, err := a.dbQueries.ListOAuthClients(req.Context(), user.ID)
+	if err != nil {
+		log.Printf("Error listing OAuth clients: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	jsonClients := make([]OAuthClient, 0, len(clients))
+	for _, client := range clients {
+		jsonClients = append(jsonClients, oauthClientFromDB(client))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(jsonClients)
+}
+
+func (a *apiConfig) deleteOAuthClientHandler(w http.ResponseWriter, req *http.Request) {
+	clientIDstr := req.PathValue("clientID")
+	clientID, err := uuid.Parse(clientIDstr)
+	if err != nil {
+		log.Printf("Invalid client ID: %s", err)
+		http.Error(w, "Invalid client ID", http.StatusBadRequest)
+		return
+	}
+
+	user, err := a.authenticateSession(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		respondAuthError(w, err)
+		return
+	}
+
+	// Deleting a client cascades to its codes and refresh tokens. Access
+	// tokens it already holds stay valid until they expire.
+	deleted, err := a.dbQueries.DeleteOAuthClient(req.Context(), database.DeleteOAuthClientParams{
+		ID:      clientID,
+		OwnerID: user.ID,
+	})
+	if err != nil {
+		log.Printf("Error deleting OAuth client: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if deleted == 0 {
+		http.Error(w, "Client not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// parseAuthorizationRequest validates the parameters of an authorization
+// request, which arrive in the query string on GET and in the form on POST.
+func (a *apiConfig) parseAuthorizationRequest(req *http.Request, params url.Values) (authorizationRequest, error) {
+	authReq := authorizationRequest{State: params.Get("state")}
+
+	clientID, err := uuid.Parse(params.Get("client_id"))
+	if err != nil {
+		return authReq, &authorizeError{Code: "invalid_request", Description: "Unknown client"}
+	}
+
+	client, err := a.dbQueries.GetOAuthClient(req.Context(), clientID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return authReq, &authorizeError{Code: "invalid_request", Description: "Unknown client"}
+	}
+	if err != nil {
+		return authReq, err
+	}
+	authReq.Client = client
+
+	redirectURI := params.Get("redirect_uri")
+	if !slices.Contains(client.RedirectUris, redirectURI) {
+		return authReq, &authorizeError{Code: "invalid_request", Description: "Redirect URI is not registered for this client"}
+	}
+	authReq.RedirectURI = redirectURI
+
+	if params.Get("response_type") != "code" {
+		return authReq, &authorizeError{Code: "unsupported_response_type", Description: "Only the code response type is supported", Redirect: true}
+	}
+
+	scopes, err := auth.ValidateScopes(strings.Fields(params.Get("scope")))
+	if err != nil {
+		return authReq, &authorizeError{Code: "invalid_scope", Description: err.Error(), Redirect: true}
+	}
+	authReq.Scopes = scopes
+
+	err = auth.ValidateCodeChallenge(params.Get("code_challenge"), params.Get("code_challenge_method"))
+	if err != nil {
+		return authReq, &authorizeError{Code: "invalid_request", Description: err.Error(), Redirect: true}
+	}
+	authReq.CodeChallenge = params.Get("code_challenge")
+
+	return authReq, nil
+}
+
+// redirectToClient sends the user back to the client with the given
+// parameters added to its redirect URI.
+func redirectToClient(w http.ResponseWriter, req *http.Request, authReq authorizationRequest, params url.Values) {
+	u, err := url.Parse(authReq.RedirectURI)
+	if err != nil {
+		log.Printf("Error parsing redirect URI: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	if authReq.State != "" {
+		query.Set("state", authReq.State)
+	}
+	u.RawQuery = query.Encode()
+
+	http.Redirect(w, req, u.String(), http.StatusFound)
+}
+
+// respondAuthorizeError reports a failed authorization request either to the
+// user or to the client, see authorizeError.
+func respondAuthorizeError(w http.ResponseWriter, req *http.Request, authReq authorizationRequest, err error) {
+	var authErr *authorizeError
+	if !errors.As(err, &authErr) {
+		log.Printf("Error handling authorization request: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if !authErr.Redirect {
+		http.Error(w, authErr.Description, http.StatusBadRequest)
+		return
+	}
+
+	redirectToClient(w, req, authReq, url.Values{
+		"error":             {authErr.Code},
+		"error_description": {authErr.Description},
+	})
+}
+
+func renderConsentPage(w http.ResponseWriter, authReq authorizationRequest, email, errMsg string, status int) {
+	// The consent page collects credentials, so it must never be framed by
+	// the client asking for access.
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+
+	err := consentTemplate.Execute(w, consentPage{
+		ClientName:    authReq.Client.Name,
+		ClientID:      authReq.Client.ID,
+		RedirectURI:   authReq.RedirectURI,
+		Scope:         strings.Join(authReq.Scopes, " "),
+		Scopes:        authReq.Scopes,
+		State:         authReq.State,
+		CodeChallenge: authReq.CodeChallenge,
+		Email:         email,
+		Error:         errMsg,
+	})
+	if err != nil {
+		log.Printf("Error rendering consent page: %s", err)
+	}
+}
+
+func (a *apiConfig) authorizeHandler(w http.ResponseWriter, req *http.Request) {
+	authReq, err := a.parseAuthorizationRequest(req, req.URL.Query())
+	if err != nil {
+		respondAuthorizeError(w, req, authReq, err)
+		return
+	}
+
+	renderConsentPage(w, authReq, "", "", http.StatusOK)
+}
+
+func (a *apiConfig) approveAuthorizationHandler(w http.ResponseWriter, req *http.Request) {
+	err := req.ParseForm()
+	if err != nil {
+		log.Printf("Error parsing authorization form: %s", err)
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	authReq, err := a.parseAuthorizationRequest(req, req.PostForm)
+	if err != nil {
+		respondAuthorizeError(w, req, authReq, err)
+		return
+	}
+
+	if req.PostForm.Get("decision") != "approve" {
+		respondAuthorizeError(w, req, authReq, &authorizeError{
+			Code:        "access_denied",
+			Description: "The user denied the request",
+			Redirect:    true,
+		})
+		return
+	}
+
+	email := req.PostForm.Get("email")
+	if !a.startLoginAttempt(w, req, email) {
+		return
+	}
+
+	user, err := a.dbQueries.GetUserByEmail(req.Context(), email)
+	if errors.Is(err, sql.ErrNoRows) {
+		a.recordLoginFailure(req, email, uuid.NullUUID{}, loginFailureUnknownEmail)
+		renderConsentPage(w, authReq, email, "Invalid email or password", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting user by email: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	userID := uuid.NullUUID{UUID: user.ID, Valid: true}
+
+	err = a.Passwords.Verify(user.HashedPassword, req.PostForm.Get("password"))
+	if err != nil {
+		log.Printf("OAuth consent login failed: %s", err)
+		a.recordLoginFailure(req, email, userID, loginFailureWrongPassword)
+		renderConsentPage(w, authReq, email, "Invalid email or password", http.StatusUnauthorized)
+		return
+	}
+
+	if user.TotpEnabledAt.Valid {
+		ok, err := a.verifySecondFactor(req.Context(), user, req.PostForm.Get("code"))
+		if err != nil {
+			log.Printf("Error verifying second factor: %s", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			a.recordLoginFailure(req, email, userID, loginFailureWrongCode)
+			renderConsentPage(w, authReq, email, "Invalid authentication code", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	a.loginSucceeded(req, email)
+
+	if user.DeletionRequestedAt.Valid {
+		renderConsentPage(w, authReq, email, "This account is scheduled for deletion", http.StatusForbidden)
+		return
+	}
+
+	code, err := auth.MakeRefreshToken()
+	if err != nil {
+		log.Printf("Error creating authorization code: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	err = a.dbQueries.CreateOAuthCode(req.Context(), database.CreateOAuthCodeParams{
+		CodeHash:      auth.HashRefreshToken(code),
+		ClientID:      authReq.Client.ID,
+		UserID:        user.ID,
+		RedirectUri:   authReq.RedirectURI,
+		Scopes:        authReq.Scopes,
+		CodeChallenge: authReq.CodeChallenge,
+	})
+	if err != nil {
+		log.Printf("Error saving authorization code: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	redirectToClient(w, req, authReq, url.Values{"code": {code}})
+}
+
+// respondOAuthError writes an error response from the token endpoints in the
+// format of RFC 6749 section 5.2.
+func respondOAuthError(w http.ResponseWriter, status int, code, description string) {
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="chirpy"`)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":             code,
+		"error_description": description,
+	})
+}
+
+// authenticateOAuthClient identifies the client calling a token endpoint.
+// Confidential clients must present their secret, either with HTTP Basic auth
+// or in the form; public clients only send their ID.
+func (a *apiConfig) authenticateOAuthClient(req *http.Request) (database.OauthClient, error) {
+	clientIDstr, secret, ok := req.BasicAuth()
+	if !ok {
+		clientIDstr = req.PostForm.Get("client_id")
+		secret = req.PostForm.Get("client_secret")
+	}
+
+	clientID, err := uuid.Parse(clientIDstr)
+	if err != nil {
+		return database.OauthClient{}, errors.New("invalid client ID")
+	}
+
+	client, err := a.dbQueries.GetOAuthClient(req.Context(), clientID)
+	if err != nil {
+		return database.OauthClient{}, err
+	}
+
+	if client.SecretHash.Valid {
+		hash := auth.HashRefreshToken(secret)
+		if subtle.ConstantTimeCompare([]byte(hash), []byte(client.SecretHash.String)) != 1 {
+			return database.OauthClient{}, errors.New("invalid client secret")
+		}
+	}
+
+	return client, nil
+}
+
+func (a *apiConfig) oauthTokenHandler(w http.ResponseWriter, req *http.Request) {
+	err := req.ParseForm()
+	if err != nil {
+		log.Printf("Error parsing token request: %s", err)
+		respondOAuthError(w, http.StatusBadRequest, "invalid_request", "Malformed request body")
+		return
+	}
+
+	client, err := a.authenticateOAuthClient(req)
+	if err != nil {
+		log.Printf("OAuth client authentication failed: %s", err)
+		respondOAuthError(w, http.StatusUnauthorized, "invalid_client", "Client authentication failed")
+		return
+	}
+
+	switch req.PostForm.Get("grant_type") {
+	case "authorization_code":
+		a.exchangeAuthorizationCode(w, req, client)
+	case "refresh_token":
+		a.exchangeOAuthRefreshToken(w, req, client)
+	default:
+		respondOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "Supported grant types are authorization_code and refresh_token")
+	}
+}
+
+func (a *apiConfig) exchangeAuthorizationCode(w http.ResponseWriter, req *http.Request, client database.OauthClient) {
+	// Consuming the code is a single conditional update, so a code can only
+	// ever be exchanged once, even by concurrent requests.
+	code, err := a.dbQueries.ConsumeOAuthCode(req.Context(), auth.HashRefreshToken(req.PostForm.Get("code")))
+	if errors.Is(err, sql.ErrNoRows) {
+		respondOAuthError(w, http.StatusBadRequest, "invalid_grant", "Authorization code is invalid, expired or already used")
+		return
+	}
+	if err != nil {
+		log.Printf("Error consuming authorization code: %s", err)
+		respondOAuthError(w, http.StatusInternalServerError, "server_error", "Internal server error")
+		return
+	}
+
+	if code.ClientID != client.ID || code.RedirectUri != req.PostForm.Get("redirect_uri") {
+		respondOAuthError(w, http.StatusBadRequest, "invalid_grant", "Authorization code was issued to another client or redirect URI")
+		return
+	}
+
+	err = auth.VerifyCodeVerifier(req.PostForm.Get("code_verifier"), code.CodeChallenge)
+	if err != nil {
+		respondOAuthError(w, http.StatusBadRequest, "invalid_grant", "Code verifier does not match the code challenge")
+		return
+	}
+
+	a.issueOAuthTokens(w, req, client, code.UserID, code.Scopes, uuid.New())
+}
+
+func (a *apiConfig) exchangeOAuthRefreshToken(w http.ResponseWriter, req *http.Request, client database.OauthClient) {
+	tokenHash := auth.HashRefreshToken(req.PostForm.Get("refresh_token"))
+	refreshToken, err := a.dbQueries.RotateOAuthRefreshToken(req.Context(), database.RotateOAuthRefreshTokenParams{
+		TokenHash: tokenHash,
+		ClientID:  client.ID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		a.rejectOAuthRefreshToken(w, req, client, tokenHash)
+		return
+	}
+	if err != nil {
+		log.Printf("Error rotating OAuth refresh token: %s", err)
+		respondOAuthError(w, http.StatusInternalServerError, "server_error", "Internal server error")
+		return
+	}
+
+	a.issueOAuthTokens(w, req, client, refreshToken.UserID, refreshToken.Scopes, refreshToken.FamilyID)
+}
+
+// rejectOAuthRefreshToken answers a refresh token that could not be rotated.
+// As with session tokens, presenting one that was already rotated means it
+// has leaked, so every token descended from the same authorization is
+// revoked.
+func (a *apiConfig) rejectOAuthRefreshToken(w http.ResponseWriter, req *http.Request, client database.OauthClient, tokenHash string) {
+	refreshToken, err := a.dbQueries.GetOAuthRefreshToken(req.Context(), database.GetOAuthRefreshTokenParams{
+		TokenHash: tokenHash,
+		ClientID:  client.ID,
+	})
+	if err == nil && refreshToken.RotatedAt.Valid {
+		log.Printf("OAuth refresh token reuse detected for user %s, revoking token family", refreshToken.UserID)
+		err = a.dbQueries.RevokeOAuthRefreshTokenFamily(req.Context(), refreshToken.FamilyID)
+		if err != nil {
+			log.Printf("Error revoking OAuth token family: %s", err)
+			respondOAuthError(w, http.StatusInternalServerError, "server_error", "Internal server error")
+			return
+		}
+	} else if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Error getting OAuth refresh token: %s", err)
+		respondOAuthError(w, http.StatusInternalServerError, "server_error", "Internal server error")
+		return
+	}
+
+	respondOAuthError(w, http.StatusBadRequest, "invalid_grant", "Refresh token is invalid, expired or revoked")
+}
+
+// issueOAuthTokens returns a new access token and a refresh token in the
+// given family, which is fresh for each authorization and carried over on
+// rotation.
+func (a *apiConfig) issueOAuthTokens(w http.ResponseWriter, req *http.Request, client database.OauthClient, userID uuid.UUID, scopes []string, familyID uuid.UUID) {
+	accessToken, err := auth.MakeDelegatedJWT(userID, client.ID.String(), scopes, a.JWT, oauthAccessTokenTTL)
+	if err != nil {
+		log.Printf("Error creating delegated JWT: %s", err)
+		respondOAuthError(w, http.StatusInternalServerError, "server_error", "Internal server error")
+		return
+	}
+
+	rtString, err := auth.MakeRefreshToken()
+	if err != nil {
+		log.Printf("Error creating refresh token: %s", err)
+		respondOAuthError(w, http.StatusInternalServerError, "server_error", "Internal server error")
+		return
+	}
+
+	err = a.dbQueries.CreateOAuthRefreshToken(req.Context(), database.CreateOAuthRefreshTokenParams{
+		TokenHash: auth.HashRefreshToken(rtString),
+		ClientID:  client.ID,
+		UserID:    userID,
+		Scopes:    scopes,
+		FamilyID:  familyID,
+	})
+	if err != nil {
+		log.Printf("Error saving OAuth refresh token: %s", err)
+		respondOAuthError(w, http.StatusInternalServerError, "server_error", "Internal server error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(OAuthTokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(oauthAccessTokenTTL.Seconds()),
+		RefreshToken: rtString,
+		Scope:        strings.Join(scopes, " "),
+	})
+}
+
+// oauthRevokeHandler implements RFC 7009. Only refresh tokens can be revoked;
+// access tokens are short-lived JWTs. Unknown tokens are not an error, so
+// clients can't use this endpoint to probe for valid tokens.
+func (a *apiConfig) oauthRevokeHandler(w http.ResponseWriter, req *http.Request) {
+	err := req.ParseForm()
+	if err != nil {
+		log.Printf("Error parsing revocation request: %s", err)
+		respondOAuthError(w, http.StatusBadRequest, "invalid_request", "Malformed request body")
+		return
+	}
+
+	client, err := a.authenticateOAuthClient(req)
+	if err != nil {
+		log.Printf("OAuth client authentication failed: %s", err)
+		respondOAuthError(w, http.StatusUnauthorized, "invalid_client", "Client authentication failed")
+		return
+	}
+
+	err = a.dbQueries.RevokeOAuthRefreshToken(req.Context(), database.RevokeOAuthRefreshTokenParams{
+		TokenHash: auth.HashRefreshToken(req.PostForm.Get("token")),
+		ClientID:  client.ID,
+	})
+	if err != nil {
+		log.Printf("Error revoking OAuth refresh token: %s", err)
+		respondOAuthError(w, http.StatusInternalServerError, "server_error", "Internal server error")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// pageRequest holds the pagination options parsed from a request's query string.
+// Cursors point at a (created_at, id) position; "after" selects rows newer than
+// the cursor and "before" selects rows older than it. A page's next_cursor
+// records which way the page was sorted, so clients send it back unchanged as
+// "cursor" and get the following page in the same order.
+type pageRequest struct {
+	Limit           int32
+	Desc            bool
+	AfterCreatedAt  sql.NullTime
+	AfterID         uuid.NullUUID
+	BeforeCreatedAt sql.NullTime
+	BeforeID        uuid.NullUUID
+}
+
+// parsePageRequest reads the page options. The order is newest first if
+// defaultDesc is set, unless "sort" says otherwise; a "cursor" carries its
+// own order and overrides both. A cursor can't be combined with "after" or
+// "before", since it already sets the bound on one side.
+func parsePageRequest(query url.Values, defaultDesc bool) (pageRequest, error) {
+	limit, err := parseLimit(query)
+	if err != nil {
+		return pageRequest{}, err
+	}
+
+	page := pageRequest{
+		Limit: limit,
+		Desc:  defaultDesc,
+	}
+
+	switch query.Get("sort") {
+	case "":
+	case "asc":
+		page.Desc = false
+	case "desc":
+		page.Desc = true
+	default:
+		return pageRequest{}, errors.New("invalid sort")
+	}
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		if query.Get("after") != "" || query.Get("before") != "" {
+			return pageRequest{}, errors.New("cursor cannot be combined with after or before")
+		}
+		dir, createdAt, id, err := decodeCursor(cursor)
+		if err != nil {
+			return pageRequest{}, err
+		}
+		page.Desc = dir == cursorDesc
+		if page.Desc {
+			page.BeforeCreatedAt = sql.NullTime{Time: createdAt, Valid: true}
+			page.BeforeID = uuid.NullUUID{UUID: id, Valid: true}
+		} else {
+			page.AfterCreatedAt = sql.NullTime{Time: createdAt, Valid: true}
+			page.AfterID = uuid.NullUUID{UUID: id, Valid: true}
+		}
+	}
+
+	if after := query.Get("after"); after != "" {
+		_, createdAt, id, err := decodeCursor(after)
+		if err != nil {
+			return pageRequest{}, err
+		}
+		page.AfterCreatedAt = sql.NullTime{Time: createdAt, Valid: true}
+		page.AfterID = uuid.NullUUID{UUID: id, Valid: true}
+	}
+
+	if before := query.Get("before"); before != "" {
+		_, createdAt, id, err := decodeCursor(before)
+		if err != nil {
+			return pageRequest{}, err
+		}
+		page.BeforeCreatedAt = sql.NullTime{Time: createdAt, Valid: true}
+		page.BeforeID = uuid.NullUUID{UUID: id, Valid: true}
+	}
+
+	return page, nil
+}
+
+// parseNewestFirstPage is parsePageRequest for lists that can only be read
+// newest first.
+func parseNewestFirstPage(query url.Values) (pageRequest, error) {
+	page, err := parsePageRequest(query, true)
+	if err != nil {
+		return pageRequest{}, err
+	}
+	if !page.Desc {
+		return pageRequest{}, errors.New("only sort=desc is supported")
+	}
+	return page, nil
+}
+
+// nextCursor returns the cursor for the page after the one ending at the
+// given row.
+func (p pageRequest) nextCursor(createdAt time.Time, id uuid.UUID) string {
+	if p.Desc {
+		return encodeCursor(cursorDesc, createdAt, id)
+	}
+	return encodeCursor(cursorAsc, createdAt, id)
+}
+
+// parseLimit reads the page size from the "limit" query parameter, clamping it
+// to maxPageLimit.
+func parseLimit(query url.Values) (int32, error) {
+	limitStr := query.Get("limit")
+	if limitStr == "" {
+		return defaultPageLimit, nil
+	}
+
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil || limit < 1 {
+		return 0, errors.New("invalid limit")
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+	return int32(limit), nil
+}
+
+// Cursor directions.
+const (
+	cursorAsc  = 'a'
+	cursorDesc = 'd'
+)
+
+// encodeCursor packs a row position, and the order of the page it ends, into
+// an opaque URL-safe string.
+func encodeCursor(dir byte, createdAt time.Time, id uuid.UUID) string {
+	raw := string(dir) + "|" + createdAt.UTC().Format(time.RFC3339Nano) + "|" + id.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor reverses encodeCursor.
+func decodeCursor(cursor string) (byte, time.Time, uuid.UUID, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, time.Time{}, uuid.Nil, errors.New("invalid cursor")
+	}
+
+	parts := strings.Split(string(raw), "|")
+	if len(parts) != 3 || (parts[0] != string(cursorAsc) && parts[0] != string(cursorDesc)) {
+		return 0, time.Time{}, uuid.Nil, errors.New("invalid cursor")
+	}
+	dir := parts[0][0]
+
+	createdAt, err := time.Parse(time.RFC3339Nano, parts[1])
+	if err != nil {
+		return 0, time.Time{}, uuid.Nil, errors.New("invalid cursor")
+	}
+
+	id, err := uuid.Parse(parts[2])
+	if err != nil {
+		return 0, time.Time{}, uuid.Nil, errors.New("invalid cursor")
+	}
+
+	return dir, createdAt, id, nil
+}
+
+// encodeRankCursor packs a position in a relevance-ranked result set, where
+// rows are ordered by (rank, id) rather than by creation time.
+func encodeRankCursor(rank float32, id uuid.UUID) string {
+	raw := strconv.FormatFloat(float64(rank), 'g', -1, 32) + "|" + id.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeRankCursor reverses encodeRankCursor.
+func decodeRankCursor(cursor string) (float32, uuid.UUID, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, uuid.Nil, errors.New("invalid cursor")
+	}
+
+	rankStr, idStr, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return 0, uuid.Nil, errors.New("invalid cursor")
+	}
+
+	rank, err := strconv.ParseFloat(rankStr, 32)
+	if err != nil {
+		return 0, uuid.Nil, errors.New("invalid cursor")
+	}
+
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return 0, uuid.Nil, errors.New("invalid cursor")
+	}
+
+	return float32(rank), id, nil
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/TheJa750/Chirpy/internal/auth"
+	"github.com/TheJa750/Chirpy/internal/database"
+	"github.com/TheJa750/Chirpy/internal/mailer"
+)
+
+func (a *apiConfig) requestPasswordResetHandler(w http.ResponseWriter, req *http.Request) {
+	var resetReq PasswordResetRequest
+	decoder := json.NewDecoder(req.Body)
+	err := decoder.Decode(&resetReq)
+	if err != nil {
+		log.Printf("Error decoding password reset request: %s", err)
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if resetReq.Email == "" {
+		http.Error(w, "Email is required", http.StatusBadRequest)
+		return
+	}
+
+	// Requests are limited per address and per client whether or not the
+	// address has an account, so the limit gives nothing away either.
+	retryAfter, err := a.reservePasswordReset(req.Context(), resetReq.Email, clientIP(req))
+	if err != nil {
+		log.Printf("Error checking password reset throttle: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", fmt.Sprint(int(retryAfter/time.Second)))
+		http.Error(w, "Too many password reset requests, try again later", http.StatusTooManyRequests)
+		return
+	}
+
+	// The response is the same whether or not the address has an account,
+	// so this endpoint can't be used to find out who is registered. The
+	// lookup and the email happen after responding, so how long the request
+	// takes doesn't give it away either.
+	ctx := context.WithoutCancel(req.Context())
+	go func() {
+		err := a.sendPasswordReset(ctx, resetReq.Email)
+		if err != nil {
+			log.Printf("Error sending password reset: %s", err)
+		}
+	}()
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// reservePasswordReset counts a reset request against the address and the
+// client IP, and returns how long to wait if either has asked too often.
+func (a *apiConfig) reservePasswordReset(ctx context.Context, email, ip string) (time.Duration, error) {
+	ipSubject := "reset-ip:" + ip
+	retryAfter, err := a.reserveAttempt(ctx, ipSubject, a.ResetIPThrottle)
+	if err != nil || retryAfter > 0 {
+		return retryAfter, err
+	}
+
+	emailSubject := "reset-email:" + strings.ToLower(strings.TrimSpace(email))
+	retryAfter, err = a.reserveAttempt(ctx, emailSubject, a.ResetEmailThrottle)
+	if err != nil || retryAfter > 0 {
+		a.releaseAttempt(ctx, ipSubject)
+	}
+	return retryAfter, err
+}
+
+func (a *apiConfig) sendPasswordReset(ctx context.Context, email string) error {
+	user, err := a.dbQueries.GetUserByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Only the newest link works.
+	err = a.dbQueries.InvalidatePasswordResets(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		return err
+	}
+
+	err = a.dbQueries.CreatePasswordReset(ctx, database.CreatePasswordResetParams{
+		TokenHash: auth.HashRefreshToken(token),
+		UserID:    user.ID,
+	})
+	if err != nil {
+		return err
+	}
+
+	return a.Mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf("Someone asked to reset the password for your Chirpy account.\n\n"+
+			"To choose a new password, send this token to POST /api/password-reset/confirm within the next hour:\n\n"+
+			"%s\n\nIf this wasn't you, you can ignore this email.\n", token),
+	})
+}
+
+func (a *apiConfig) confirmPasswordResetHandler(w http.ResponseWriter, req *http.Request) {
+	var confirmReq PasswordResetConfirmation
+	decoder := json.NewDecoder(req.Body)
+	err := decoder.Decode(&confirmReq)
+	if err != nil {
+		log.Printf("Error decoding password reset confirmation: %s", err)
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if confirmReq.Password == "" {
+		http.Error(w, "Password is required", http.StatusBadRequest)
+		return
+	}
+
+	// Checked before the token is consumed, so a rejected password doesn't
+	// use up the reset link.
+	if a.rejectWeakPassword(w, confirmReq.Password) {
+		return
+	}
+
+	// Consuming the token is a single conditional update, so each link can
+	// only be used once.
+	reset, err := a.dbQueries.ConsumePasswordReset(req.Context(), auth.HashRefreshToken(confirmReq.Token))
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Reset token is invalid or expired", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Error consuming password reset: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	hashedPassword, err := a.Passwords.Hash(confirmReq.Password)
+	if err != nil {
+		log.Printf("Error hashing password: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	err = a.dbQueries.UpdateUserPassword(req.Context(), database.UpdateUserPasswordParams{
+		ID:             reset.UserID,
+		HashedPassword: hashedPassword,
+	})
+	if err != nil {
+		log.Printf("Error updating password: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Whoever had access to the account before the reset is signed out.
+	err = revokeAllCredentials(req.Context(), a.dbQueries, reset.UserID)
+	if err != nil {
+		log.Printf("Error revoking user sessions: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// A reset proves control of the mailbox, so it also lifts any lockout
+	// on the account.
+	user, err := a.dbQueries.GetUserByID(req.Context(), reset.UserID)
+	if err != nil {
+		log.Printf("Error getting user by ID: %s", err)
+	} else {
+		a.clearLoginFailures(req.Context(), user.Email)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
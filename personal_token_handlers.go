@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/TheJa750/Chirpy/internal/auth"
+	"github.com/TheJa750/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultPersonalTokenDays = 30
+	maxPersonalTokenDays     = 365
+	maxPersonalTokenName     = 100
+)
+
+func personalAccessTokenFromDB(pat database.PersonalAccessToken) PersonalAccessToken {
+	token := PersonalAccessToken{
+		ID:        pat.ID,
+		Name:      pat.Name,
+		Scopes:    pat.Scopes,
+		CreatedAt: pat.CreatedAt.Time,
+		ExpiresAt: pat.ExpiresAt,
+	}
+	if pat.LastUsedAt.Valid {
+		token.LastUsedAt = &pat.LastUsedAt.Time
+	}
+	return token
+}
+
+func (a *apiConfig) createPersonalTokenHandler(w http.ResponseWriter, req *http.Request) {
+	decoder := json.NewDecoder(req.Body)
+	tokenReq := PersonalAccessTokenRequest{}
+	err := decoder.Decode(&tokenReq)
+	if err != nil {
+		log.Printf("Error decoding token request: %s", err)
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	// Personal access tokens can't mint more of themselves, so a leaked token
+	// can't be used to keep access after it is revoked.
+	user, err := a.authenticateSession(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		respondAuthError(w, err)
+		return
+	}
+
+	name := strings.TrimSpace(tokenReq.Name)
+	if name == "" || len(name) > maxPersonalTokenName {
+		http.Error(w, "Token name must be between 1 and 100 characters", http.StatusBadRequest)
+		return
+	}
+
+	scopes, err := auth.ValidateScopes(tokenReq.Scopes)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	days := tokenReq.ExpiresInDays
+	if days == 0 {
+		days = defaultPersonalTokenDays
+	}
+	if days < 1 || days > maxPersonalTokenDays {
+		http.Error(w, "Token expiry must be between 1 and 365 days", http.StatusBadRequest)
+		return
+	}
+
+	patString, err := auth.MakePersonalAccessToken()
+	if err != nil {
+		log.Printf("Error creating personal access token: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	pat, err := a.dbQueries.CreatePersonalAccessToken(req.Context(), database.CreatePersonalAccessTokenParams{
+		UserID:    user.ID,
+		Name:      name,
+		TokenHash: auth.HashPersonalAccessToken(patString),
+		Scopes:    scopes,
+		ExpiresAt: time.Now().AddDate(0, 0, days),
+	})
+	if err != nil {
+		log.Printf("Error saving personal access token: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// The raw token is only ever shown here; afterwards only its hash exists.
+	jsonToken := personalAccessTokenFromDB(pat)
+	jsonToken.Token = patString
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(jsonToken)
+}
+
+func (a *apiConfig) listPersonalTokensHandler(w http.ResponseWriter, req *http.Request) {
+	user, err := a.authenticateSession(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		respondAuthError(w, err)
+		return
+	}
+
+	pats, err := a.dbQueries.ListPersonalAccessTokens(req.Context(), user.ID)
+	if err != nil {
+		log.Printf("Error listing personal access tokens: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	jsonTokens := make([]PersonalAccessToken, 0, len(pats))
+	for _, pat := range pats {
+		jsonTokens = append(jsonTokens, personalAccessTokenFromDB(pat))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(jsonTokens)
+}
+
+func (a *apiConfig) revokePersonalTokenHandler(w http.ResponseWriter, req *http.Request) {
+	tokenIDstr := req.PathValue("tokenID")
+	tokenID, err := uuid.Parse(tokenIDstr)
+	if err != nil {
+		log.Printf("Invalid token ID: %s", err)
+		http.Error(w, "Invalid token ID", http.StatusBadRequest)
+		return
+	}
+
+	user, err := a.authenticateSession(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		respondAuthError(w, err)
+		return
+	}
+
+	revoked, err := a.dbQueries.RevokePersonalAccessToken(req.Context(), database.RevokePersonalAccessTokenParams{
+		ID:     tokenID,
+		UserID: user.ID,
+	})
+	if err != nil {
+		log.Printf("Error revoking personal access token: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if revoked == 0 {
+		http.Error(w, "Token not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/TheJa750/Chirpy/internal/auth"
+	"github.com/TheJa750/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	maxDisplayNameLength = 50
+	maxBioLength         = 160
+	maxAvatarURLLength   = 2048
+)
+
+// validateProfile checks the fields present in a profile update and returns
+// them ready to be stored; absent fields stay null and are left unchanged.
+func validateProfile(profileReq ProfileRequest) (database.UpdateUserProfileParams, error) {
+	var params database.UpdateUserProfileParams
+
+	if profileReq.Handle != nil {
+		if *profileReq.Handle == "" {
+			return params, errors.New("handle cannot be empty")
+		}
+		handle, err := normalizeHandle(*profileReq.Handle)
+		if err != nil {
+			return params, err
+		}
+		params.Handle = sql.NullString{String: handle, Valid: true}
+	}
+
+	if profileReq.DisplayName != nil {
+		if utf8.RuneCountInString(*profileReq.DisplayName) > maxDisplayNameLength {
+			return params, errors.New("display name is too long")
+		}
+		params.DisplayName = sql.NullString{String: *profileReq.DisplayName, Valid: true}
+	}
+
+	if profileReq.Bio != nil {
+		if utf8.RuneCountInString(*profileReq.Bio) > maxBioLength {
+			return params, errors.New("bio is too long")
+		}
+		params.Bio = sql.NullString{String: *profileReq.Bio, Valid: true}
+	}
+
+	if profileReq.AvatarURL != nil {
+		if *profileReq.AvatarURL != "" {
+			if len(*profileReq.AvatarURL) > maxAvatarURLLength {
+				return params, errors.New("avatar URL is too long")
+			}
+			avatarURL, err := url.Parse(*profileReq.AvatarURL)
+			if err != nil || (avatarURL.Scheme != "http" && avatarURL.Scheme != "https") || avatarURL.Host == "" {
+				return params, errors.New("avatar URL must be an http or https URL")
+			}
+		}
+		params.AvatarUrl = sql.NullString{String: *profileReq.AvatarURL, Valid: true}
+	}
+
+	return params, nil
+}
+
+func (a *apiConfig) userProfile(req *http.Request, user database.User) (UserProfile, error) {
+	stats, err := a.dbQueries.GetUserProfileStats(req.Context(), user.ID)
+	if err != nil {
+		return UserProfile{}, err
+	}
+
+	return UserProfile{
+		ID:             user.ID,
+		Handle:         user.Handle,
+		DisplayName:    user.DisplayName,
+		Bio:            user.Bio,
+		AvatarURL:      user.AvatarUrl,
+		CreatedAt:      user.CreatedAt.Time,
+		ChirpyRed:      user.IsChirpyRed,
+		ChirpCount:     stats.ChirpCount,
+		FollowerCount:  stats.FollowerCount,
+		FollowingCount: stats.FollowingCount,
+	}, nil
+}
+
+// getUserProfileHandler returns a user's public profile. The path accepts
+// either a handle or a user ID, so clients can resolve the user_id on a chirp.
+// The profile never includes the account's email.
+func (a *apiConfig) getUserProfileHandler(w http.ResponseWriter, req *http.Request) {
+	ref := req.PathValue("handle")
+
+	var user database.User
+	var err error
+	if userID, parseErr := uuid.Parse(ref); parseErr == nil {
+		user, err = a.dbQueries.GetUserByID(req.Context(), userID)
+	} else {
+		user, err = a.dbQueries.GetUserByHandle(req.Context(), strings.ToLower(strings.TrimPrefix(ref, "@")))
+	}
+	if err != nil {
+		log.Printf("Error getting user profile: %s", err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	// A disabled account is hidden along with its chirps.
+	if user.DeletionRequestedAt.Valid {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	profile, err := a.userProfile(req, user)
+	if err != nil {
+		log.Printf("Error getting user profile stats: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(profile)
+}
+
+func (a *apiConfig) updateProfileHandler(w http.ResponseWriter, req *http.Request) {
+	userID, err := a.authenticate(req, auth.ScopeProfileWrite)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		respondAuthError(w, err)
+		return
+	}
+
+	var profileReq ProfileRequest
+	decoder := json.NewDecoder(req.Body)
+	err = decoder.Decode(&profileReq)
+	if err != nil {
+		log.Printf("Error decoding profile request: %s", err)
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	params, err := validateProfile(profileReq)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	params.ID = userID
+
+	user, err := a.dbQueries.UpdateUserProfile(req.Context(), params)
+	if isUniqueViolation(err, "users_handle_key") {
+		http.Error(w, "Handle is already taken", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating user profile: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	profile, err := a.userProfile(req, user)
+	if err != nil {
+		log.Printf("Error getting user profile stats: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(profile)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/TheJa750/Chirpy/internal/auth"
+	"github.com/TheJa750/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// recentAuthTTL is how long a recent-auth token can stand in for the
+// current password.
+const recentAuthTTL = 5 * time.Minute
+
+// verifyCurrentCredentials checks the password, and the second factor if the
+// user has one, of someone who already holds an access token. Failures count
+// towards the same throttle as logins, so a stolen access token can't be
+// used to guess the password. It writes the error response and returns false
+// if the check fails.
+func (a *apiConfig) verifyCurrentCredentials(w http.ResponseWriter, req *http.Request, user database.User, password, code string) bool {
+	if !a.startLoginAttempt(w, req, user.Email) {
+		return false
+	}
+	return a.checkCredentials(w, req, user, password, code)
+}
+
+// checkCredentials is verifyCurrentCredentials for callers that have already
+// called startLoginAttempt.
+func (a *apiConfig) checkCredentials(w http.ResponseWriter, req *http.Request, user database.User, password, code string) bool {
+	userID := uuid.NullUUID{UUID: user.ID, Valid: true}
+
+	err := a.Passwords.Verify(user.HashedPassword, password)
+	if err != nil {
+		log.Printf("Password check failed: %s", err)
+		a.recordLoginFailure(req, user.Email, userID, loginFailureWrongPassword)
+		http.Error(w, "Invalid current password", http.StatusForbidden)
+		return false
+	}
+
+	if user.TotpEnabledAt.Valid {
+		if code == "" {
+			a.abandonLoginAttempt(req, user.Email)
+			http.Error(w, "Authentication code is required", http.StatusForbidden)
+			return false
+		}
+
+		ok, err := a.verifySecondFactor(req.Context(), user, code)
+		if err != nil {
+			log.Printf("Error verifying second factor: %s", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return false
+		}
+		if !ok {
+			a.recordLoginFailure(req, user.Email, userID, loginFailureWrongCode)
+			http.Error(w, "Invalid authentication code", http.StatusForbidden)
+			return false
+		}
+	}
+
+	a.loginSucceeded(req, user.Email)
+	return true
+}
+
+// requireRecentAuth accepts either a recent-auth token issued to the user or
+// their current credentials. It writes the error response and returns false
+// if neither is valid.
+func (a *apiConfig) requireRecentAuth(w http.ResponseWriter, req *http.Request, user database.User, updateReq AccountUpdateRequest) bool {
+	if updateReq.RecentAuthToken != "" {
+		tokenUserID, err := auth.ValidateRecentAuthToken(updateReq.RecentAuthToken, a.JWT)
+		if err != nil || tokenUserID != user.ID {
+			log.Printf("Invalid recent-auth token: %v", err)
+			http.Error(w, "Recent authentication token is invalid or expired", http.StatusForbidden)
+			return false
+		}
+		return true
+	}
+
+	if updateReq.CurrentPassword == "" {
+		http.Error(w, "current_password or recent_auth_token is required", http.StatusForbidden)
+		return false
+	}
+
+	return a.verifyCurrentCredentials(w, req, user, updateReq.CurrentPassword, updateReq.Code)
+}
+
+// reauthenticateHandler exchanges the current password, and a second factor
+// if enabled, for a short-lived recent-auth token.
+func (a *apiConfig) reauthenticateHandler(w http.ResponseWriter, req *http.Request) {
+	user, err := a.authenticateSession(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		respondAuthError(w, err)
+		return
+	}
+
+	var reauthReq ReauthenticationRequest
+	decoder := json.NewDecoder(req.Body)
+	err = decoder.Decode(&reauthReq)
+	if err != nil {
+		log.Printf("Error decoding reauthentication request: %s", err)
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if reauthReq.Password == "" {
+		http.Error(w, "Password is required", http.StatusBadRequest)
+		return
+	}
+
+	if !a.verifyCurrentCredentials(w, req, user, reauthReq.Password, reauthReq.Code) {
+		return
+	}
+
+	expiresAt := time.Now().Add(recentAuthTTL)
+	recentAuthToken, err := auth.MakeRecentAuthToken(user.ID, a.JWT, recentAuthTTL)
+	if err != nil {
+		log.Printf("Error creating recent-auth token: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(RecentAuthToken{
+		Token:     recentAuthToken,
+		ExpiresAt: expiresAt,
+	})
+}
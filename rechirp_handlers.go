@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/TheJa750/Chirpy/internal/auth"
+	"github.com/TheJa750/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// embedReferencedChirps replaces the ID-only RechirpOf and QuoteOf references
+// left by chirpFromDB with the full chirps they point at, and returns the
+// embedded chirps. Embedding is one level deep: a quoted chirp's own
+// references are dropped rather than expanded.
+func (a *apiConfig) embedReferencedChirps(ctx context.Context, chirps []*Chirp) ([]*Chirp, error) {
+	var ids []uuid.UUID
+	for _, chirp := range chirps {
+		if chirp.RechirpOf != nil {
+			ids = append(ids, chirp.RechirpOf.ID)
+		}
+		if chirp.QuoteOf != nil {
+			ids = append(ids, chirp.QuoteOf.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	referenced, err := a.dbQueries.GetReferencedChirps(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[uuid.UUID]database.Chirp, len(referenced))
+	for _, chirp := range referenced {
+		byID[chirp.ID] = chirp
+	}
+
+	embed := func(ref *Chirp) *Chirp {
+		row, ok := byID[ref.ID]
+		if !ok {
+			return nil
+		}
+		jsonChirp := chirpFromDB(row)
+		jsonChirp.RechirpOf = nil
+		jsonChirp.QuoteOf = nil
+		return &jsonChirp
+	}
+
+	var embedded []*Chirp
+	for _, chirp := range chirps {
+		if chirp.RechirpOf != nil {
+			chirp.RechirpOf = embed(chirp.RechirpOf)
+			if chirp.RechirpOf != nil {
+				embedded = append(embedded, chirp.RechirpOf)
+			}
+		}
+		if chirp.QuoteOf != nil {
+			chirp.QuoteOf = embed(chirp.QuoteOf)
+			if chirp.QuoteOf != nil {
+				embedded = append(embedded, chirp.QuoteOf)
+			}
+		}
+	}
+
+	return embedded, nil
+}
+
+func (a *apiConfig) rechirpHandler(w http.ResponseWriter, req *http.Request) {
+	chirpIDstr := req.PathValue("chirpID")
+	chirpID, err := uuid.Parse(chirpIDstr)
+	if err != nil {
+		log.Printf("Invalid chirp ID: %s", err)
+		http.Error(w, "Invalid chirp ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := a.authenticate(req, auth.ScopeChirpsWrite)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		respondAuthError(w, err)
+		return
+	}
+
+	original, err := a.dbQueries.GetChirpByID(req.Context(), chirpID)
+	if err != nil {
+		log.Printf("Error getting chirp by ID: %s", err)
+		http.Error(w, "Chirp not found", http.StatusNotFound)
+		return
+	}
+
+	// Rechirping a rechirp shares the chirp it points at.
+	if original.RechirpOfID.Valid {
+		chirpID = original.RechirpOfID.UUID
+	}
+
+	chirp, err := a.dbQueries.CreateRechirp(req.Context(), database.CreateRechirpParams{
+		UserID:  userID,
+		ChirpID: chirpID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Chirp already rechirped", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error creating rechirp: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	jsonChirp := chirpFromDB(chirp)
+
+	err = a.prepareChirps(req, []*Chirp{&jsonChirp})
+	if err != nil {
+		log.Printf("Error preparing chirps: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(jsonChirp)
+}
+
+func (a *apiConfig) undoRechirpHandler(w http.ResponseWriter, req *http.Request) {
+	chirpIDstr := req.PathValue("chirpID")
+	chirpID, err := uuid.Parse(chirpIDstr)
+	if err != nil {
+		log.Printf("Invalid chirp ID: %s", err)
+		http.Error(w, "Invalid chirp ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := a.authenticate(req, auth.ScopeChirpsWrite)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		respondAuthError(w, err)
+		return
+	}
+
+	deleted, err := a.dbQueries.DeleteRechirp(req.Context(), database.DeleteRechirpParams{
+		UserID:  userID,
+		ChirpID: chirpID,
+	})
+	if err != nil {
+		log.Printf("Error deleting rechirp: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if deleted == 0 {
+		http.Error(w, "Rechirp not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
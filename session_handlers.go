@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/TheJa750/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func (a *apiConfig) listSessionsHandler(w http.ResponseWriter, req *http.Request) {
+	user, err := a.authenticateSession(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		respondAuthError(w, err)
+		return
+	}
+
+	sessions, err := a.dbQueries.ListActiveSessions(req.Context(), user.ID)
+	if err != nil {
+		log.Printf("Error listing sessions: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	jsonSessions := make([]Session, 0, len(sessions))
+	for _, session := range sessions {
+		jsonSessions = append(jsonSessions, Session{
+			ID:         session.ID,
+			UserAgent:  session.UserAgent,
+			IPAddress:  session.IpAddress,
+			CreatedAt:  session.CreatedAt.Time,
+			LastUsedAt: session.LastUsedAt.Time,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(jsonSessions)
+}
+
+func (a *apiConfig) revokeSessionHandler(w http.ResponseWriter, req *http.Request) {
+	sessionIDstr := req.PathValue("sessionID")
+	sessionID, err := uuid.Parse(sessionIDstr)
+	if err != nil {
+		log.Printf("Invalid session ID: %s", err)
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	user, err := a.authenticateSession(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		respondAuthError(w, err)
+		return
+	}
+
+	// Sessions belonging to other users are reported as missing so their
+	// IDs can't be probed.
+	revoked, err := a.dbQueries.RevokeUserSession(req.Context(), database.RevokeUserSessionParams{
+		FamilyID: sessionID,
+		UserID:   user.ID,
+	})
+	if err != nil {
+		log.Printf("Error revoking session: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if revoked == 0 {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// revokeAllCredentials signs the user out everywhere: every session, every
+// personal access token and every app they have authorized. Access tokens
+// already issued stay valid until they expire.
+func revokeAllCredentials(ctx context.Context, q *database.Queries, userID uuid.UUID) error {
+	err := q.RevokeAllUserTokens(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	err = q.RevokeAllPersonalAccessTokens(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	return q.RevokeAllOAuthRefreshTokens(ctx, userID)
+}
+
+func (a *apiConfig) logoutAllHandler(w http.ResponseWriter, req *http.Request) {
+	user, err := a.authenticateSession(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		respondAuthError(w, err)
+		return
+	}
+
+	err = revokeAllCredentials(req.Context(), a.dbQueries, user.ID)
+	if err != nil {
+		log.Printf("Error revoking sessions: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
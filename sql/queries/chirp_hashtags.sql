@@ -0,0 +1,22 @@
+-- name: CreateChirpHashtags :exec
+INSERT INTO chirp_hashtags (chirp_id, tag, created_at)
+SELECT chirps.id, unnest(sqlc.arg('tags')::text[]), chirps.created_at
+FROM chirps
+WHERE chirps.id = sqlc.arg('chirp_id')::uuid
+ON CONFLICT DO NOTHING;
+
+-- name: DeleteChirpHashtags :exec
+DELETE FROM chirp_hashtags
+WHERE chirp_id = $1;
+
+-- name: GetTrendingHashtags :many
+SELECT chirp_hashtags.tag,
+    SUM(EXP(-LN(2) * EXTRACT(EPOCH FROM (NOW() - chirp_hashtags.created_at)) / sqlc.arg('half_life_seconds')::float8))::float8 AS score,
+    COUNT(*) AS uses
+FROM chirp_hashtags
+JOIN chirps ON chirps.id = chirp_hashtags.chirp_id
+WHERE chirp_hashtags.created_at > NOW() - make_interval(secs => sqlc.arg('window_seconds')::float8)
+  AND chirps.deleted_at IS NULL AND chirps.hidden_at IS NULL
+GROUP BY chirp_hashtags.tag
+ORDER BY score DESC, tag ASC
+LIMIT sqlc.arg('page_limit');
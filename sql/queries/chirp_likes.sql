@@ -0,0 +1,22 @@
+-- name: LikeChirp :exec
+INSERT INTO chirp_likes (user_id, chirp_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT DO NOTHING;
+
+-- name: UnlikeChirp :exec
+DELETE FROM chirp_likes
+WHERE user_id = $1 AND chirp_id = $2;
+
+-- name: GetLikedChirpIDs :many
+SELECT chirp_id FROM chirp_likes
+WHERE user_id = sqlc.arg('user_id') AND chirp_id = ANY(sqlc.arg('chirp_ids')::uuid[]);
+
+-- name: ListUserLikes :many
+SELECT * FROM chirp_likes
+WHERE user_id = sqlc.arg('user_id')
+  AND (sqlc.narg('after_created_at')::timestamp IS NULL
+    OR (created_at, chirp_id) > (sqlc.narg('after_created_at')::timestamp, sqlc.narg('after_id')::uuid))
+  AND (sqlc.narg('before_created_at')::timestamp IS NULL
+    OR (created_at, chirp_id) < (sqlc.narg('before_created_at')::timestamp, sqlc.narg('before_id')::uuid))
+ORDER BY created_at DESC, chirp_id DESC
+LIMIT sqlc.arg('page_limit');
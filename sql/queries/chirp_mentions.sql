@@ -0,0 +1,8 @@
+-- name: CreateChirpMentions :exec
+INSERT INTO chirp_mentions (chirp_id, user_id, created_at)
+SELECT sqlc.arg('chirp_id')::uuid, unnest(sqlc.arg('user_ids')::uuid[]), NOW()
+ON CONFLICT DO NOTHING;
+
+-- name: DeleteChirpMentions :exec
+DELETE FROM chirp_mentions
+WHERE chirp_id = $1;
@@ -1,21 +1,207 @@
 -- name: CreateChirp :one
-INSERT INTO chirps (id, body, created_at, updated_at, user_id)
-VALUES (gen_random_uuid(), $1, NOW(), NOW(), $2)
+INSERT INTO chirps (id, body, created_at, updated_at, user_id, parent_id, quote_of_id)
+VALUES (gen_random_uuid(), $1, NOW(), NOW(), $2, $3, $4)
 RETURNING *;
 
--- name: GetChirps :many
-SELECT * FROM chirps
-ORDER BY created_at ASC;
+-- name: CreateRechirp :one
+INSERT INTO chirps (id, body, created_at, updated_at, user_id, rechirp_of_id)
+VALUES (gen_random_uuid(), '', NOW(), NOW(), sqlc.arg('user_id'), sqlc.arg('chirp_id')::uuid)
+ON CONFLICT (user_id, rechirp_of_id) WHERE rechirp_of_id IS NOT NULL DO NOTHING
+RETURNING *;
 
--- name: GetChirpsByUserID :many
-SELECT * FROM chirps
-WHERE user_id = $1
-ORDER BY created_at ASC;
+-- name: DeleteRechirp :execrows
+DELETE FROM chirps
+WHERE user_id = sqlc.arg('user_id') AND rechirp_of_id = sqlc.arg('chirp_id')::uuid;
+
+-- name: DeleteRechirpsOf :exec
+DELETE FROM chirps
+WHERE rechirp_of_id = sqlc.arg('chirp_id')::uuid;
 
 -- name: GetChirpByID :one
 SELECT * FROM chirps
-WHERE id = $1;
+WHERE id = $1 AND deleted_at IS NULL AND hidden_at IS NULL;
+
+-- name: LockChirpByID :one
+SELECT * FROM chirps
+WHERE id = $1 AND deleted_at IS NULL AND hidden_at IS NULL
+FOR UPDATE;
+
+-- name: ChirpHasReplies :one
+SELECT EXISTS (SELECT 1 FROM chirps WHERE parent_id = $1) AS has_replies;
 
 -- name: DeleteChirpByID :exec
 DELETE FROM chirps
-WHERE id = $1;
\ No newline at end of file
+WHERE id = $1;
+
+-- name: TombstoneChirpByID :exec
+UPDATE chirps
+SET body = '', deleted_at = NOW(), updated_at = NOW()
+WHERE id = $1;
+
+-- name: ListChirpsAsc :many
+SELECT * FROM chirps
+WHERE deleted_at IS NULL AND hidden_at IS NULL
+  AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id')::uuid)
+  AND (sqlc.narg('after_created_at')::timestamp IS NULL
+    OR (created_at, id) > (sqlc.narg('after_created_at')::timestamp, sqlc.narg('after_id')::uuid))
+  AND (sqlc.narg('before_created_at')::timestamp IS NULL
+    OR (created_at, id) < (sqlc.narg('before_created_at')::timestamp, sqlc.narg('before_id')::uuid))
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('page_limit');
+
+-- name: ListChirpsDesc :many
+SELECT * FROM chirps
+WHERE deleted_at IS NULL AND hidden_at IS NULL
+  AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id')::uuid)
+  AND (sqlc.narg('after_created_at')::timestamp IS NULL
+    OR (created_at, id) > (sqlc.narg('after_created_at')::timestamp, sqlc.narg('after_id')::uuid))
+  AND (sqlc.narg('before_created_at')::timestamp IS NULL
+    OR (created_at, id) < (sqlc.narg('before_created_at')::timestamp, sqlc.narg('before_id')::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('page_limit');
+
+-- name: UpdateChirp :one
+WITH previous AS (
+    INSERT INTO chirp_revisions (id, chirp_id, body, created_at)
+    SELECT gen_random_uuid(), id, body, NOW() FROM chirps
+    WHERE id = $1 AND user_id = $3 AND deleted_at IS NULL AND hidden_at IS NULL
+    FOR UPDATE
+)
+UPDATE chirps
+SET body = $2, updated_at = NOW()
+WHERE id = $1 AND user_id = $3 AND deleted_at IS NULL AND hidden_at IS NULL
+RETURNING *;
+
+-- name: GetChirpAncestors :many
+WITH RECURSIVE ancestors AS (
+    SELECT parent.id, parent.parent_id, 1 AS depth
+    FROM chirps parent
+    WHERE parent.id = (SELECT child.parent_id FROM chirps child WHERE child.id = $1)
+      AND parent.hidden_at IS NULL
+    UNION ALL
+    SELECT parent.id, parent.parent_id, ancestors.depth + 1
+    FROM chirps parent
+    JOIN ancestors ON parent.id = ancestors.parent_id
+    WHERE parent.hidden_at IS NULL
+)
+SELECT chirps.* FROM chirps
+JOIN ancestors ON chirps.id = ancestors.id
+ORDER BY ancestors.depth DESC;
+
+-- name: GetChirpReplies :many
+WITH RECURSIVE replies AS (
+    SELECT child.id
+    FROM chirps child
+    WHERE child.parent_id = sqlc.arg('chirp_id')::uuid
+      AND child.hidden_at IS NULL
+    UNION ALL
+    SELECT child.id
+    FROM chirps child
+    JOIN replies ON child.parent_id = replies.id
+    WHERE child.hidden_at IS NULL
+)
+SELECT chirps.* FROM chirps
+JOIN replies ON chirps.id = replies.id
+ORDER BY chirps.created_at ASC, chirps.id ASC;
+
+-- name: ListTimelineAsc :many
+SELECT * FROM chirps
+WHERE deleted_at IS NULL AND hidden_at IS NULL
+  AND (user_id = sqlc.arg('user_id')
+    OR user_id IN (SELECT followee_id FROM follows WHERE follower_id = sqlc.arg('user_id')))
+  AND (sqlc.narg('after_created_at')::timestamp IS NULL
+    OR (created_at, id) > (sqlc.narg('after_created_at')::timestamp, sqlc.narg('after_id')::uuid))
+  AND (sqlc.narg('before_created_at')::timestamp IS NULL
+    OR (created_at, id) < (sqlc.narg('before_created_at')::timestamp, sqlc.narg('before_id')::uuid))
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('page_limit');
+
+-- name: ListTimelineDesc :many
+SELECT * FROM chirps
+WHERE deleted_at IS NULL AND hidden_at IS NULL
+  AND (user_id = sqlc.arg('user_id')
+    OR user_id IN (SELECT followee_id FROM follows WHERE follower_id = sqlc.arg('user_id')))
+  AND (sqlc.narg('after_created_at')::timestamp IS NULL
+    OR (created_at, id) > (sqlc.narg('after_created_at')::timestamp, sqlc.narg('after_id')::uuid))
+  AND (sqlc.narg('before_created_at')::timestamp IS NULL
+    OR (created_at, id) < (sqlc.narg('before_created_at')::timestamp, sqlc.narg('before_id')::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('page_limit');
+
+-- name: GetChirpsByIDs :many
+SELECT * FROM chirps
+WHERE id = ANY(sqlc.arg('ids')::uuid[]) AND deleted_at IS NULL AND hidden_at IS NULL;
+
+-- name: GetReferencedChirps :many
+SELECT * FROM chirps
+WHERE id = ANY(sqlc.arg('ids')::uuid[]) AND hidden_at IS NULL;
+
+-- name: SearchChirps :many
+WITH matches AS (
+    SELECT id, ts_rank(search_vector, websearch_to_tsquery('english', sqlc.arg('query')::text)) AS rank
+    FROM chirps
+    WHERE search_vector @@ websearch_to_tsquery('english', sqlc.arg('query')::text)
+      AND deleted_at IS NULL AND hidden_at IS NULL
+      AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id')::uuid)
+)
+SELECT id, rank::real AS rank FROM matches
+WHERE sqlc.narg('after_rank')::real IS NULL
+   OR (rank, id) < (sqlc.narg('after_rank')::real, sqlc.narg('after_id')::uuid)
+ORDER BY rank DESC, id DESC
+LIMIT sqlc.arg('page_limit');
+
+-- name: ListHashtagChirpsAsc :many
+SELECT chirps.* FROM chirps
+JOIN chirp_hashtags ON chirp_hashtags.chirp_id = chirps.id
+WHERE chirp_hashtags.tag = sqlc.arg('tag')
+  AND chirps.deleted_at IS NULL AND chirps.hidden_at IS NULL
+  AND (sqlc.narg('after_created_at')::timestamp IS NULL
+    OR (chirps.created_at, chirps.id) > (sqlc.narg('after_created_at')::timestamp, sqlc.narg('after_id')::uuid))
+  AND (sqlc.narg('before_created_at')::timestamp IS NULL
+    OR (chirps.created_at, chirps.id) < (sqlc.narg('before_created_at')::timestamp, sqlc.narg('before_id')::uuid))
+ORDER BY chirps.created_at ASC, chirps.id ASC
+LIMIT sqlc.arg('page_limit');
+
+-- name: ListHashtagChirpsDesc :many
+SELECT chirps.* FROM chirps
+JOIN chirp_hashtags ON chirp_hashtags.chirp_id = chirps.id
+WHERE chirp_hashtags.tag = sqlc.arg('tag')
+  AND chirps.deleted_at IS NULL AND chirps.hidden_at IS NULL
+  AND (sqlc.narg('after_created_at')::timestamp IS NULL
+    OR (chirps.created_at, chirps.id) > (sqlc.narg('after_created_at')::timestamp, sqlc.narg('after_id')::uuid))
+  AND (sqlc.narg('before_created_at')::timestamp IS NULL
+    OR (chirps.created_at, chirps.id) < (sqlc.narg('before_created_at')::timestamp, sqlc.narg('before_id')::uuid))
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg('page_limit');
+
+-- name: ListMentionChirps :many
+SELECT chirps.* FROM chirps
+JOIN chirp_mentions ON chirp_mentions.chirp_id = chirps.id
+WHERE chirp_mentions.user_id = sqlc.arg('user_id')
+  AND chirps.deleted_at IS NULL AND chirps.hidden_at IS NULL
+  AND (sqlc.narg('after_created_at')::timestamp IS NULL
+    OR (chirps.created_at, chirps.id) > (sqlc.narg('after_created_at')::timestamp, sqlc.narg('after_id')::uuid))
+  AND (sqlc.narg('before_created_at')::timestamp IS NULL
+    OR (chirps.created_at, chirps.id) < (sqlc.narg('before_created_at')::timestamp, sqlc.narg('before_id')::uuid))
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg('page_limit');
+
+-- name: HideUserChirps :exec
+UPDATE chirps
+SET hidden_at = NOW()
+WHERE hidden_at IS NULL
+  AND (user_id = $1 OR rechirp_of_id IN (SELECT id FROM chirps WHERE user_id = $1));
+
+-- name: RestoreUserChirps :exec
+UPDATE chirps
+SET hidden_at = NULL
+FROM users
+WHERE chirps.user_id = users.id
+  AND users.deletion_requested_at IS NULL
+  AND chirps.hidden_at IS NOT NULL
+  AND (chirps.user_id = $1 OR chirps.rechirp_of_id IN (SELECT id FROM chirps WHERE user_id = $1))
+  AND NOT EXISTS (
+    SELECT 1 FROM chirps original
+    JOIN users author ON author.id = original.user_id
+    WHERE original.id = chirps.rechirp_of_id AND author.deletion_requested_at IS NOT NULL
+  );
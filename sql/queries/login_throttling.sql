@@ -0,0 +1,38 @@
+-- name: GetLoginRetryAfter :one
+SELECT COALESCE(CEIL(EXTRACT(EPOCH FROM MAX(blocked_until) - NOW())), 0)::integer AS retry_after_seconds
+FROM login_throttles
+WHERE subject = ANY(sqlc.arg('subjects')::text[]) AND blocked_until > NOW();
+
+-- name: ReserveLoginAttempt :one
+INSERT INTO login_throttles (subject, failures, last_failure_at, blocked_until)
+VALUES (
+    sqlc.arg('subject'),
+    1,
+    NOW(),
+    NOW() + make_interval(secs => (sqlc.arg('delay_seconds')::integer[])[1])
+)
+ON CONFLICT (subject) DO UPDATE
+SET failures = CASE
+        WHEN login_throttles.last_failure_at < NOW() - make_interval(secs => sqlc.arg('window_seconds')::integer) THEN 1
+        ELSE login_throttles.failures + 1
+    END,
+    last_failure_at = NOW(),
+    blocked_until = NOW() + make_interval(secs => (sqlc.arg('delay_seconds')::integer[])[CASE
+        WHEN login_throttles.last_failure_at < NOW() - make_interval(secs => sqlc.arg('window_seconds')::integer) THEN 1
+        ELSE LEAST(login_throttles.failures + 1, array_length(sqlc.arg('delay_seconds')::integer[], 1))
+    END])
+WHERE login_throttles.blocked_until IS NULL OR login_throttles.blocked_until <= NOW()
+RETURNING failures;
+
+-- name: ReleaseLoginAttempt :exec
+UPDATE login_throttles
+SET failures = GREATEST(failures - 1, 0), blocked_until = NULL
+WHERE subject = $1;
+
+-- name: ClearLoginThrottle :exec
+DELETE FROM login_throttles
+WHERE subject = $1;
+
+-- name: CreateLoginFailure :exec
+INSERT INTO login_failures (id, email, user_id, ip_address, user_agent, reason, created_at)
+VALUES (gen_random_uuid(), $1, $2, $3, $4, $5, NOW());
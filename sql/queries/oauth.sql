@@ -0,0 +1,56 @@
+-- name: CreateOAuthClient :one
+INSERT INTO oauth_clients (id, owner_id, name, redirect_uris, secret_hash, created_at)
+VALUES (gen_random_uuid(), $1, $2, $3, $4, NOW())
+RETURNING *;
+
+-- name: GetOAuthClient :one
+SELECT * FROM oauth_clients
+WHERE id = $1;
+
+-- name: ListOAuthClients :many
+SELECT * FROM oauth_clients
+WHERE owner_id = $1
+ORDER BY created_at DESC;
+
+-- name: DeleteOAuthClient :execrows
+DELETE FROM oauth_clients
+WHERE id = $1 AND owner_id = $2;
+
+-- name: CreateOAuthCode :exec
+INSERT INTO oauth_authorization_codes (code_hash, client_id, user_id, redirect_uri, scopes, code_challenge, created_at, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6, NOW(), NOW() + INTERVAL '10 minutes');
+
+-- name: ConsumeOAuthCode :one
+UPDATE oauth_authorization_codes
+SET used_at = NOW()
+WHERE code_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+RETURNING *;
+
+-- name: CreateOAuthRefreshToken :exec
+INSERT INTO oauth_refresh_tokens (token_hash, client_id, user_id, scopes, family_id, created_at, expires_at)
+VALUES ($1, $2, $3, $4, $5, NOW(), NOW() + INTERVAL '60 days');
+
+-- name: GetOAuthRefreshToken :one
+SELECT * FROM oauth_refresh_tokens
+WHERE token_hash = $1 AND client_id = $2;
+
+-- name: RotateOAuthRefreshToken :one
+UPDATE oauth_refresh_tokens
+SET revoked_at = NOW(), rotated_at = NOW()
+WHERE token_hash = $1 AND client_id = $2 AND revoked_at IS NULL AND expires_at > NOW()
+RETURNING *;
+
+-- name: RevokeOAuthRefreshToken :exec
+UPDATE oauth_refresh_tokens
+SET revoked_at = NOW()
+WHERE token_hash = $1 AND client_id = $2 AND revoked_at IS NULL;
+
+-- name: RevokeOAuthRefreshTokenFamily :exec
+UPDATE oauth_refresh_tokens
+SET revoked_at = NOW()
+WHERE family_id = $1 AND revoked_at IS NULL;
+
+-- name: RevokeAllOAuthRefreshTokens :exec
+UPDATE oauth_refresh_tokens
+SET revoked_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL;
@@ -1,19 +1,41 @@
 -- name: CreateUserToken :one
 INSERT INTO refresh_tokens (
-    token,
+    token_hash,
     created_at,
     updated_at,
     user_id,
-    expires_at
+    expires_at,
+    family_id
 )
-VALUES ($1, NOW(), NOW(), $2, NOW() + INTERVAL '60 days')
+VALUES ($1, NOW(), NOW(), $2, NOW() + INTERVAL '60 days', $3)
 RETURNING *;
 
 -- name: GetUserByToken :one
 SELECT * FROM refresh_tokens
-WHERE token = $1;
+WHERE token_hash = $1;
 
 -- name: RevokeUserToken :exec
 UPDATE refresh_tokens
 SET revoked_at = NOW()
-WHERE token = $1;
\ No newline at end of file
+WHERE token_hash = $1;
+
+-- name: RotateUserToken :one
+UPDATE refresh_tokens
+SET revoked_at = NOW(), rotated_at = NOW(), updated_at = NOW()
+WHERE token_hash = $1 AND revoked_at IS NULL AND expires_at > NOW()
+RETURNING *;
+
+-- name: RevokeTokenFamily :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE family_id = $1 AND revoked_at IS NULL;
+
+-- name: RevokeUserSession :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE family_id = $1 AND user_id = $2 AND revoked_at IS NULL;
+
+-- name: RevokeAllUserTokens :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL;
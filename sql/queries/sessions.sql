@@ -0,0 +1,19 @@
+-- name: CreateSession :one
+INSERT INTO sessions (id, user_id, user_agent, ip_address, created_at, last_used_at)
+VALUES (gen_random_uuid(), $1, $2, $3, NOW(), NOW())
+RETURNING *;
+
+-- name: TouchSession :exec
+UPDATE sessions
+SET user_agent = $2, ip_address = $3, last_used_at = NOW()
+WHERE id = $1;
+
+-- name: ListActiveSessions :many
+SELECT * FROM sessions
+WHERE user_id = $1 AND EXISTS (
+    SELECT 1 FROM refresh_tokens
+    WHERE refresh_tokens.family_id = sessions.id
+      AND refresh_tokens.revoked_at IS NULL
+      AND refresh_tokens.expires_at > NOW()
+)
+ORDER BY last_used_at DESC;
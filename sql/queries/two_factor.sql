@@ -0,0 +1,48 @@
+-- name: SetPendingTOTPSecret :exec
+UPDATE users
+SET totp_secret = $2, updated_at = NOW()
+WHERE id = $1 AND totp_enabled_at IS NULL;
+
+-- name: EnableTOTP :execrows
+UPDATE users
+SET totp_enabled_at = NOW(), totp_last_step = $2, updated_at = NOW()
+WHERE id = $1 AND totp_secret IS NOT NULL AND totp_enabled_at IS NULL;
+
+-- name: DisableTOTP :exec
+UPDATE users
+SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = 0, updated_at = NOW()
+WHERE id = $1;
+
+-- name: UseTOTPStep :execrows
+UPDATE users
+SET totp_last_step = $2
+WHERE id = $1 AND totp_last_step < $2;
+
+-- name: CreateRecoveryCode :exec
+INSERT INTO recovery_codes (id, user_id, code_hash, created_at)
+VALUES (gen_random_uuid(), $1, $2, NOW());
+
+-- name: DeleteRecoveryCodes :exec
+DELETE FROM recovery_codes
+WHERE user_id = $1;
+
+-- name: UseRecoveryCode :execrows
+UPDATE recovery_codes
+SET used_at = NOW()
+WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL;
+
+-- name: CreateLoginChallenge :one
+INSERT INTO login_challenges (token_hash, user_id, created_at, expires_at)
+VALUES ($1, $2, NOW(), NOW() + INTERVAL '5 minutes')
+RETURNING *;
+
+-- name: AttemptLoginChallenge :one
+UPDATE login_challenges
+SET attempts = attempts + 1
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW() AND attempts < 5
+RETURNING *;
+
+-- name: CompleteLoginChallenge :execrows
+UPDATE login_challenges
+SET used_at = NOW()
+WHERE token_hash = $1 AND used_at IS NULL;
@@ -1,10 +1,10 @@
 -- name: CreateUser :one
-INSERT INTO users (id, email, hashed_password, created_at, updated_at)
-VALUES (gen_random_uuid(), $1, $2, NOW(), NOW())
+INSERT INTO users (id, email, hashed_password, handle, created_at, updated_at)
+VALUES (gen_random_uuid(), $1, $2, $3, NOW(), NOW())
 RETURNING *;
 
 -- name: ResetUsers :exec
-TRUNCATE TABLE users CASCADE;
+TRUNCATE TABLE users, login_throttles CASCADE;
 
 -- name: GetUserByEmail :one
 SELECT * FROM users WHERE email = $1;
@@ -12,14 +12,72 @@ SELECT * FROM users WHERE email = $1;
 -- name: GetUserByID :one
 SELECT * FROM users WHERE id = $1;
 
--- name: UpdateUser :one
+-- name: UpdateUserEmail :one
 UPDATE users
-SET email = $1, updated_at = NOW(), hashed_password = $2
-WHERE id = $3
+SET pending_email = CASE WHEN sqlc.arg('email')::text = email THEN NULL ELSE sqlc.arg('email')::text END,
+    updated_at = NOW()
+WHERE id = sqlc.arg('id')
 RETURNING *;
 
 -- name: UpgradeUserToChirpyRed :one
 UPDATE users
 SET is_chirpy_red = TRUE
 WHERE id = $1
-RETURNING *;
\ No newline at end of file
+RETURNING *;
+
+-- name: GetUsersByHandles :many
+SELECT * FROM users WHERE handle = ANY(sqlc.arg('handles')::text[]);
+
+-- name: GetUserByHandle :one
+SELECT * FROM users WHERE handle = $1;
+
+-- name: UpdateUserProfile :one
+UPDATE users
+SET handle = COALESCE(sqlc.narg('handle')::text, handle),
+    display_name = COALESCE(sqlc.narg('display_name')::text, display_name),
+    bio = COALESCE(sqlc.narg('bio')::text, bio),
+    avatar_url = COALESCE(sqlc.narg('avatar_url')::text, avatar_url),
+    updated_at = NOW()
+WHERE id = sqlc.arg('id')
+RETURNING *;
+
+-- name: GetUserProfileStats :one
+SELECT
+    (SELECT COUNT(*) FROM chirps WHERE chirps.user_id = $1 AND chirps.deleted_at IS NULL AND chirps.hidden_at IS NULL) AS chirp_count,
+    (SELECT COUNT(*) FROM follows WHERE follows.followee_id = $1) AS follower_count,
+    (SELECT COUNT(*) FROM follows WHERE follows.follower_id = $1) AS following_count;
+
+-- name: UpdateUserPassword :exec
+UPDATE users
+SET hashed_password = $2, updated_at = NOW()
+WHERE id = $1;
+
+-- name: UpgradeUserPasswordHash :exec
+UPDATE users
+SET hashed_password = sqlc.arg('new_hash')
+WHERE id = sqlc.arg('id') AND hashed_password = sqlc.arg('old_hash');
+
+-- name: ConfirmEmail :one
+UPDATE users
+SET email = sqlc.arg('email')::text,
+    pending_email = CASE WHEN pending_email = sqlc.arg('email')::text THEN NULL ELSE pending_email END,
+    email_verified_at = CASE WHEN email = sqlc.arg('email')::text THEN COALESCE(email_verified_at, NOW()) ELSE NOW() END,
+    updated_at = NOW()
+WHERE id = sqlc.arg('id') AND (email = sqlc.arg('email')::text OR pending_email = sqlc.arg('email')::text)
+RETURNING *;
+
+-- name: RequestUserDeletion :one
+UPDATE users
+SET deletion_requested_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND deletion_requested_at IS NULL
+RETURNING *;
+
+-- name: CancelUserDeletion :one
+UPDATE users
+SET deletion_requested_at = NULL, updated_at = NOW()
+WHERE id = $1 AND deletion_requested_at IS NOT NULL
+RETURNING *;
+
+-- name: PurgeDeletedUsers :execrows
+DELETE FROM users
+WHERE deletion_requested_at < NOW() - make_interval(secs => sqlc.arg('grace_seconds')::integer);
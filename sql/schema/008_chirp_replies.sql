@@ -0,0 +1,43 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD parent_id UUID REFERENCES chirps(id) ON DELETE SET NULL,
+ADD reply_count INTEGER NOT NULL DEFAULT 0,
+ADD deleted_at TIMESTAMP DEFAULT NULL;
+
+CREATE INDEX chirps_parent_id_idx ON chirps (parent_id);
+
+-- reply_count is kept in step with the live (non-tombstoned) replies by a
+-- trigger so concurrent replies and deletes can't race each other.
+-- +goose StatementBegin
+CREATE FUNCTION chirps_update_reply_count() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        IF NEW.parent_id IS NOT NULL AND NEW.deleted_at IS NULL THEN
+            UPDATE chirps SET reply_count = reply_count + 1 WHERE id = NEW.parent_id;
+        END IF;
+    ELSIF TG_OP = 'DELETE' THEN
+        IF OLD.parent_id IS NOT NULL AND OLD.deleted_at IS NULL THEN
+            UPDATE chirps SET reply_count = reply_count - 1 WHERE id = OLD.parent_id;
+        END IF;
+    ELSIF TG_OP = 'UPDATE' THEN
+        IF OLD.parent_id IS NOT NULL AND OLD.deleted_at IS NULL AND NEW.deleted_at IS NOT NULL THEN
+            UPDATE chirps SET reply_count = reply_count - 1 WHERE id = OLD.parent_id;
+        END IF;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER chirps_reply_count
+AFTER INSERT OR DELETE OR UPDATE OF deleted_at ON chirps
+FOR EACH ROW EXECUTE FUNCTION chirps_update_reply_count();
+
+-- +goose Down
+DROP TRIGGER chirps_reply_count ON chirps;
+DROP FUNCTION chirps_update_reply_count();
+DROP INDEX chirps_parent_id_idx;
+ALTER TABLE chirps
+DROP COLUMN deleted_at,
+DROP COLUMN reply_count,
+DROP COLUMN parent_id;
@@ -0,0 +1,15 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD rechirp_of_id UUID REFERENCES chirps(id) ON DELETE CASCADE,
+ADD quote_of_id UUID REFERENCES chirps(id) ON DELETE SET NULL;
+
+CREATE UNIQUE INDEX chirps_user_id_rechirp_of_id_idx ON chirps (user_id, rechirp_of_id)
+WHERE rechirp_of_id IS NOT NULL;
+CREATE INDEX chirps_quote_of_id_idx ON chirps (quote_of_id);
+
+-- +goose Down
+DROP INDEX chirps_quote_of_id_idx;
+DROP INDEX chirps_user_id_rechirp_of_id_idx;
+ALTER TABLE chirps
+DROP COLUMN quote_of_id,
+DROP COLUMN rechirp_of_id;
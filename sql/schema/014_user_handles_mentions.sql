@@ -0,0 +1,24 @@
+-- +goose Up
+ALTER TABLE users
+ADD handle TEXT;
+
+UPDATE users
+SET handle = 'user_' || substr(md5(id::text), 1, 12);
+
+ALTER TABLE users
+ALTER COLUMN handle SET NOT NULL,
+ADD CONSTRAINT users_handle_key UNIQUE (handle);
+
+CREATE TABLE chirp_mentions (
+    chirp_id UUID NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (chirp_id, user_id)
+);
+
+CREATE INDEX chirp_mentions_user_id_idx ON chirp_mentions (user_id);
+
+-- +goose Down
+DROP TABLE chirp_mentions;
+ALTER TABLE users
+DROP COLUMN handle;
@@ -0,0 +1,19 @@
+-- +goose Up
+ALTER TABLE refresh_tokens
+ADD family_id UUID,
+ADD rotated_at TIMESTAMP DEFAULT NULL;
+
+-- Tokens issued before rotation existed each start their own family.
+UPDATE refresh_tokens
+SET family_id = gen_random_uuid();
+
+ALTER TABLE refresh_tokens
+ALTER COLUMN family_id SET NOT NULL;
+
+CREATE INDEX refresh_tokens_family_id_idx ON refresh_tokens (family_id);
+
+-- +goose Down
+DROP INDEX refresh_tokens_family_id_idx;
+ALTER TABLE refresh_tokens
+DROP COLUMN rotated_at,
+DROP COLUMN family_id;
@@ -0,0 +1,18 @@
+-- +goose Up
+ALTER TABLE refresh_tokens
+RENAME COLUMN token TO token_hash;
+
+-- Existing sessions keep working: clients still hold the raw value and the
+-- server hashes whatever it is given before looking it up.
+UPDATE refresh_tokens
+SET token_hash = encode(sha256(convert_to(token_hash, 'UTF8')), 'hex');
+
+-- +goose Down
+-- The raw tokens can't be recovered, so every session is revoked on the way
+-- down.
+UPDATE refresh_tokens
+SET revoked_at = NOW()
+WHERE revoked_at IS NULL;
+
+ALTER TABLE refresh_tokens
+RENAME COLUMN token_hash TO token;
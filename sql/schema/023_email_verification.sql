@@ -0,0 +1,14 @@
+-- +goose Up
+ALTER TABLE users
+ADD email_verified_at TIMESTAMP DEFAULT NULL,
+-- A new address waiting to be confirmed; email keeps the old one until then.
+ADD pending_email TEXT DEFAULT NULL;
+
+-- Accounts created before verification existed are trusted as they are.
+UPDATE users
+SET email_verified_at = NOW();
+
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN pending_email,
+DROP COLUMN email_verified_at;
@@ -0,0 +1,29 @@
+-- +goose Up
+-- Failed login counters, keyed by subject: "email:<address>" or "ip:<addr>".
+-- Kept in the database rather than in memory so every instance sees the
+-- same counts.
+CREATE TABLE login_throttles (
+    subject TEXT PRIMARY KEY,
+    failures INTEGER NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMP NOT NULL,
+    blocked_until TIMESTAMP DEFAULT NULL
+);
+
+-- Audit trail of every rejected login. user_id is set when the email matched
+-- an account.
+CREATE TABLE login_failures (
+    id UUID PRIMARY KEY,
+    email TEXT NOT NULL,
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    ip_address TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    reason TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX login_failures_email_idx ON login_failures (email, created_at);
+CREATE INDEX login_failures_user_id_idx ON login_failures (user_id);
+
+-- +goose Down
+DROP TABLE login_failures;
+DROP TABLE login_throttles;
@@ -0,0 +1,61 @@
+-- +goose Up
+-- Set when the user asks for their account to be deleted. The account is
+-- disabled straight away and removed for good once the grace period has
+-- passed, unless the request is cancelled first.
+ALTER TABLE users
+ADD deletion_requested_at TIMESTAMP DEFAULT NULL;
+
+CREATE INDEX users_deletion_requested_at_idx ON users (deletion_requested_at)
+WHERE deletion_requested_at IS NOT NULL;
+
+-- Chirps of an account pending deletion are hidden by setting deleted_at
+-- without clearing the body, and brought back if the deletion is cancelled.
+-- reply_count now has to follow chirps coming back as well as going away.
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION chirps_update_reply_count() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        IF NEW.parent_id IS NOT NULL AND NEW.deleted_at IS NULL THEN
+            UPDATE chirps SET reply_count = reply_count + 1 WHERE id = NEW.parent_id;
+        END IF;
+    ELSIF TG_OP = 'DELETE' THEN
+        IF OLD.parent_id IS NOT NULL AND OLD.deleted_at IS NULL THEN
+            UPDATE chirps SET reply_count = reply_count - 1 WHERE id = OLD.parent_id;
+        END IF;
+    ELSIF TG_OP = 'UPDATE' THEN
+        IF OLD.parent_id IS NOT NULL AND OLD.deleted_at IS NULL AND NEW.deleted_at IS NOT NULL THEN
+            UPDATE chirps SET reply_count = reply_count - 1 WHERE id = OLD.parent_id;
+        ELSIF NEW.parent_id IS NOT NULL AND OLD.deleted_at IS NOT NULL AND NEW.deleted_at IS NULL THEN
+            UPDATE chirps SET reply_count = reply_count + 1 WHERE id = NEW.parent_id;
+        END IF;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION chirps_update_reply_count() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        IF NEW.parent_id IS NOT NULL AND NEW.deleted_at IS NULL THEN
+            UPDATE chirps SET reply_count = reply_count + 1 WHERE id = NEW.parent_id;
+        END IF;
+    ELSIF TG_OP = 'DELETE' THEN
+        IF OLD.parent_id IS NOT NULL AND OLD.deleted_at IS NULL THEN
+            UPDATE chirps SET reply_count = reply_count - 1 WHERE id = OLD.parent_id;
+        END IF;
+    ELSIF TG_OP = 'UPDATE' THEN
+        IF OLD.parent_id IS NOT NULL AND OLD.deleted_at IS NULL AND NEW.deleted_at IS NOT NULL THEN
+            UPDATE chirps SET reply_count = reply_count - 1 WHERE id = OLD.parent_id;
+        END IF;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+DROP INDEX users_deletion_requested_at_idx;
+ALTER TABLE users
+DROP COLUMN deletion_requested_at;
@@ -0,0 +1,83 @@
+-- +goose Up
+-- Chirps of an account pending deletion are hidden rather than tombstoned,
+-- so they drop out of threads and embeds instead of showing up as deleted,
+-- and come back untouched if the deletion is cancelled.
+ALTER TABLE chirps
+ADD hidden_at TIMESTAMP DEFAULT NULL;
+
+-- reply_count only counts replies that are neither tombstoned nor hidden.
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION chirps_update_reply_count() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        IF NEW.parent_id IS NOT NULL AND NEW.deleted_at IS NULL AND NEW.hidden_at IS NULL THEN
+            UPDATE chirps SET reply_count = reply_count + 1 WHERE id = NEW.parent_id;
+        END IF;
+    ELSIF TG_OP = 'DELETE' THEN
+        IF OLD.parent_id IS NOT NULL AND OLD.deleted_at IS NULL AND OLD.hidden_at IS NULL THEN
+            UPDATE chirps SET reply_count = reply_count - 1 WHERE id = OLD.parent_id;
+        END IF;
+    ELSIF TG_OP = 'UPDATE' THEN
+        IF OLD.parent_id IS NOT NULL AND OLD.deleted_at IS NULL AND OLD.hidden_at IS NULL
+            AND (NEW.deleted_at IS NOT NULL OR NEW.hidden_at IS NOT NULL) THEN
+            UPDATE chirps SET reply_count = reply_count - 1 WHERE id = OLD.parent_id;
+        ELSIF NEW.parent_id IS NOT NULL AND NEW.deleted_at IS NULL AND NEW.hidden_at IS NULL
+            AND (OLD.deleted_at IS NOT NULL OR OLD.hidden_at IS NOT NULL) THEN
+            UPDATE chirps SET reply_count = reply_count + 1 WHERE id = NEW.parent_id;
+        END IF;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+DROP TRIGGER chirps_reply_count ON chirps;
+CREATE TRIGGER chirps_reply_count
+AFTER INSERT OR DELETE OR UPDATE OF deleted_at, hidden_at ON chirps
+FOR EACH ROW EXECUTE FUNCTION chirps_update_reply_count();
+
+-- Chirps already hidden through deleted_at move over once the trigger knows
+-- about hidden_at, so reply_count isn't touched: they stay uncounted.
+UPDATE chirps
+SET hidden_at = chirps.deleted_at, deleted_at = NULL
+FROM users
+WHERE chirps.user_id = users.id
+  AND chirps.deleted_at = users.deletion_requested_at;
+
+-- +goose Down
+-- Moved back while the trigger still knows about hidden_at, for the same
+-- reason.
+UPDATE chirps
+SET deleted_at = hidden_at, hidden_at = NULL
+WHERE hidden_at IS NOT NULL AND deleted_at IS NULL;
+
+DROP TRIGGER chirps_reply_count ON chirps;
+CREATE TRIGGER chirps_reply_count
+AFTER INSERT OR DELETE OR UPDATE OF deleted_at ON chirps
+FOR EACH ROW EXECUTE FUNCTION chirps_update_reply_count();
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION chirps_update_reply_count() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        IF NEW.parent_id IS NOT NULL AND NEW.deleted_at IS NULL THEN
+            UPDATE chirps SET reply_count = reply_count + 1 WHERE id = NEW.parent_id;
+        END IF;
+    ELSIF TG_OP = 'DELETE' THEN
+        IF OLD.parent_id IS NOT NULL AND OLD.deleted_at IS NULL THEN
+            UPDATE chirps SET reply_count = reply_count - 1 WHERE id = OLD.parent_id;
+        END IF;
+    ELSIF TG_OP = 'UPDATE' THEN
+        IF OLD.parent_id IS NOT NULL AND OLD.deleted_at IS NULL AND NEW.deleted_at IS NOT NULL THEN
+            UPDATE chirps SET reply_count = reply_count - 1 WHERE id = OLD.parent_id;
+        ELSIF NEW.parent_id IS NOT NULL AND OLD.deleted_at IS NOT NULL AND NEW.deleted_at IS NULL THEN
+            UPDATE chirps SET reply_count = reply_count + 1 WHERE id = NEW.parent_id;
+        END IF;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+ALTER TABLE chirps
+DROP COLUMN hidden_at;
@@ -1,18 +1,40 @@
 package main
 
 import (
+	"database/sql"
 	"sync/atomic"
 	"time"
 
+	"github.com/TheJa750/Chirpy/internal/auth"
 	"github.com/TheJa750/Chirpy/internal/database"
+	"github.com/TheJa750/Chirpy/internal/mailer"
 	"github.com/google/uuid"
 )
 
 type apiConfig struct {
 	fileserverHits atomic.Int32
+	db             *sql.DB
 	dbQueries      *database.Queries
-	JWTSecret      string
+	JWT            auth.JWTConfig
+	Passwords      auth.PasswordHasher
+	PasswordPolicy *auth.PasswordPolicy
 	PolkaKey       string
+	Mailer         mailer.Mailer
+	// BaseURL is where the API is reachable from outside, used to build
+	// links in emails.
+	BaseURL string
+	// ReadOnlyUntilVerified stops accounts with an unverified email from
+	// using any write scope.
+	ReadOnlyUntilVerified bool
+	// EmailThrottle and IPThrottle slow down repeated failed logins.
+	EmailThrottle auth.LoginThrottle
+	IPThrottle    auth.LoginThrottle
+	// ResetEmailThrottle and ResetIPThrottle limit password reset requests.
+	ResetEmailThrottle auth.LoginThrottle
+	ResetIPThrottle    auth.LoginThrottle
+	// DeletionGracePeriod is how long a deleted account can still be
+	// restored before it is removed for good.
+	DeletionGracePeriod time.Duration
 }
 
 const adminMetrics = `<html>
@@ -26,35 +48,230 @@ type JsonError struct {
 	Message string `json:"error"`
 }
 
+// PasswordPolicyError lists every password rule a request broke, so the
+// client can show them all at once.
+type PasswordPolicyError struct {
+	Message    string                   `json:"error"`
+	Violations []auth.PasswordViolation `json:"violations"`
+}
+
 type CleanedChirpBody struct {
 	Body string `json:"cleaned_body"`
 }
 
 type User struct {
-	ID           uuid.UUID `json:"id"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-	Email        string    `json:"email"`
-	AccessToken  string    `json:"token"`
-	RefreshToken string    `json:"refresh_token"`
-	ChirpyRed    bool      `json:"is_chirpy_red"`
+	ID            uuid.UUID `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"email_verified"`
+	PendingEmail  string    `json:"pending_email,omitempty"`
+	Handle        string    `json:"handle"`
+	AccessToken   string    `json:"token"`
+	RefreshToken  string    `json:"refresh_token"`
+	ChirpyRed     bool      `json:"is_chirpy_red"`
+}
+
+type UserProfile struct {
+	ID             uuid.UUID `json:"id"`
+	Handle         string    `json:"handle"`
+	DisplayName    string    `json:"display_name"`
+	Bio            string    `json:"bio"`
+	AvatarURL      string    `json:"avatar_url"`
+	CreatedAt      time.Time `json:"created_at"`
+	ChirpyRed      bool      `json:"is_chirpy_red"`
+	ChirpCount     int64     `json:"chirp_count"`
+	FollowerCount  int64     `json:"follower_count"`
+	FollowingCount int64     `json:"following_count"`
+}
+
+type ProfileRequest struct {
+	Handle      *string `json:"handle"`
+	DisplayName *string `json:"display_name"`
+	Bio         *string `json:"bio"`
+	AvatarURL   *string `json:"avatar_url"`
 }
 
 type chirpRequest struct {
-	Body string `json:"body"`
+	Body      string     `json:"body"`
+	InReplyTo *uuid.UUID `json:"in_reply_to"`
+	QuoteOf   *uuid.UUID `json:"quote_of"`
 }
 
 type Chirp struct {
+	ID         uuid.UUID  `json:"id"`
+	Body       string     `json:"body"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	UserID     uuid.UUID  `json:"user_id"`
+	InReplyTo  *uuid.UUID `json:"in_reply_to,omitempty"`
+	ReplyCount int32      `json:"reply_count"`
+	LikeCount  int32      `json:"like_count"`
+	LikedByMe  *bool      `json:"liked_by_me,omitempty"`
+	RechirpOf  *Chirp     `json:"rechirp_of,omitempty"`
+	QuoteOf    *Chirp     `json:"quote_of,omitempty"`
+	Deleted    bool       `json:"deleted,omitempty"`
+}
+
+type ThreadChirp struct {
+	Chirp
+	Replies []*ThreadChirp `json:"replies"`
+}
+
+type ChirpThread struct {
+	Ancestors []Chirp      `json:"ancestors"`
+	Chirp     *ThreadChirp `json:"chirp"`
+}
+
+type ChirpRevision struct {
 	ID        uuid.UUID `json:"id"`
+	ChirpID   uuid.UUID `json:"chirp_id"`
 	Body      string    `json:"body"`
 	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	UserID    uuid.UUID `json:"user_id"`
+}
+
+type ChirpPage struct {
+	Chirps     []Chirp `json:"chirps"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
+
+type TrendingHashtag struct {
+	Tag   string  `json:"tag"`
+	Score float64 `json:"score"`
+	Uses  int64   `json:"uses"`
+}
+
+type Follow struct {
+	UserID     uuid.UUID `json:"user_id"`
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+type FollowPage struct {
+	Users      []Follow `json:"users"`
+	NextCursor string   `json:"next_cursor,omitempty"`
+}
+
+type Session struct {
+	ID         uuid.UUID `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+}
+
+type PersonalAccessToken struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Token      string     `json:"token,omitempty"`
+}
+
+type PersonalAccessTokenRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days"`
+}
+
+type OAuthClient struct {
+	ClientID     uuid.UUID `json:"client_id"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	ClientSecret string    `json:"client_secret,omitempty"`
+	Confidential bool      `json:"confidential"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type OAuthClientRequest struct {
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Confidential bool     `json:"confidential"`
+}
+
+type OAuthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+}
+
+type TwoFactorEnrollment struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+type TwoFactorRequest struct {
+	Code     string `json:"code"`
+	Password string `json:"password"`
+}
+
+type RecoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type LoginChallenge struct {
+	TwoFactorRequired bool      `json:"two_factor_required"`
+	ChallengeToken    string    `json:"challenge_token"`
+	ExpiresAt         time.Time `json:"expires_at"`
+}
+
+type LoginTwoFactorRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+}
+
+type PasswordResetRequest struct {
+	Email string `json:"email"`
+}
+
+type PasswordResetConfirmation struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
 }
 
 type UserRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	Handle   string `json:"handle"`
+}
+
+// AccountUpdateRequest changes the email, the password or both. Empty fields
+// are left as they are. Either CurrentPassword (with Code if two-factor
+// authentication is on) or RecentAuthToken must be given.
+type AccountUpdateRequest struct {
+	Email           string `json:"email"`
+	Password        string `json:"password"`
+	CurrentPassword string `json:"current_password"`
+	Code            string `json:"code"`
+	RecentAuthToken string `json:"recent_auth_token"`
+}
+
+type ReauthenticationRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+type RecentAuthToken struct {
+	Token     string    `json:"recent_auth_token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type AccountDeletionRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+type AccountDeletion struct {
+	DeleteAfter time.Time `json:"delete_after"`
+}
+
+type CancelDeletionRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	Code     string `json:"code"`
 }
 
 type PolkaEvent struct {
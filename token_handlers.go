@@ -1,14 +1,61 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"time"
 
 	"github.com/TheJa750/Chirpy/internal/auth"
+	"github.com/TheJa750/Chirpy/internal/database"
+	"github.com/google/uuid"
 )
 
+// createSession starts a new session for the user and returns the first
+// refresh token issued in it. A session is a refresh token family: every
+// token rotated out of this one keeps the session's ID as its family ID.
+func (a *apiConfig) createSession(req *http.Request, userID uuid.UUID) (string, error) {
+	session, err := a.dbQueries.CreateSession(req.Context(), database.CreateSessionParams{
+		UserID:    userID,
+		UserAgent: req.UserAgent(),
+		IpAddress: clientIP(req),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	rtString, err := auth.MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = a.dbQueries.CreateUserToken(req.Context(), database.CreateUserTokenParams{
+		TokenHash: auth.HashRefreshToken(rtString),
+		UserID:    userID,
+		FamilyID:  session.ID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return rtString, nil
+}
+
+// clientIP returns the address of the peer that made the request, without
+// its port.
+func clientIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
 func (a *apiConfig) refreshHandler(w http.ResponseWriter, req *http.Request) {
 	token, err := auth.GetBearerToken(req.Header)
 	if err != nil {
@@ -17,28 +64,105 @@ func (a *apiConfig) refreshHandler(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	refreshToken, err := a.dbQueries.GetUserByToken(req.Context(), token)
+	// Rotating is a single conditional update, so of two requests racing with
+	// the same token only one can win; the loser is treated as a replay.
+	refreshToken, err := a.dbQueries.RotateUserToken(req.Context(), auth.HashRefreshToken(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		a.rejectRefreshToken(w, req, token)
+		return
+	}
 	if err != nil {
-		log.Printf("Error getting refresh token: %s", err)
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		log.Printf("Error rotating refresh token: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	if refreshToken.RevokedAt.Valid {
-		http.Error(w, "Refresh token has been revoked", http.StatusUnauthorized)
+	// Deletion revokes every session, but a refresh racing with it could
+	// still rotate; a disabled account gets no new tokens either way.
+	user, err := a.dbQueries.GetUserByID(req.Context(), refreshToken.UserID)
+	if err != nil {
+		log.Printf("Error getting user by ID: %s", err)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if user.DeletionRequestedAt.Valid {
+		http.Error(w, "Account is scheduled for deletion", http.StatusForbidden)
 		return
 	}
 
-	newAccessToken, err := auth.MakeJWT(refreshToken.UserID, a.JWTSecret, 3600*time.Second)
+	newAccessToken, err := auth.MakeJWT(refreshToken.UserID, a.JWT, 3600*time.Second)
 	if err != nil {
 		log.Printf("Error creating new access token: %s", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
+	rtString, err := auth.MakeRefreshToken()
+	if err != nil {
+		log.Printf("Error creating refresh token: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = a.dbQueries.CreateUserToken(req.Context(), database.CreateUserTokenParams{
+		TokenHash: auth.HashRefreshToken(rtString),
+		UserID:    refreshToken.UserID,
+		FamilyID:  refreshToken.FamilyID,
+	})
+	if err != nil {
+		log.Printf("Error creating refresh token in database: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	err = a.dbQueries.TouchSession(req.Context(), database.TouchSessionParams{
+		ID:        refreshToken.FamilyID,
+		UserAgent: req.UserAgent(),
+		IpAddress: clientIP(req),
+	})
+	if err != nil {
+		log.Printf("Error updating session: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"token": newAccessToken})
+	json.NewEncoder(w).Encode(map[string]string{
+		"token":         newAccessToken,
+		"refresh_token": rtString,
+	})
+}
+
+// rejectRefreshToken responds to a refresh token that could not be rotated.
+// A token that was already rotated away is being replayed, which means it has
+// leaked: every token descended from the same login is revoked.
+func (a *apiConfig) rejectRefreshToken(w http.ResponseWriter, req *http.Request, token string) {
+	refreshToken, err := a.dbQueries.GetUserByToken(req.Context(), auth.HashRefreshToken(token))
+	if err != nil {
+		log.Printf("Error getting refresh token: %s", err)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if refreshToken.RotatedAt.Valid {
+		log.Printf("Refresh token reuse detected for user %s, revoking token family", refreshToken.UserID)
+		err = a.dbQueries.RevokeTokenFamily(req.Context(), refreshToken.FamilyID)
+		if err != nil {
+			log.Printf("Error revoking token family: %s", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		http.Error(w, "Refresh token has already been used", http.StatusUnauthorized)
+		return
+	}
+
+	if refreshToken.RevokedAt.Valid {
+		http.Error(w, "Refresh token has been revoked", http.StatusUnauthorized)
+		return
+	}
+
+	http.Error(w, "Refresh token has expired", http.StatusUnauthorized)
 }
 
 func (a *apiConfig) revokeRefreshTokenHandler(w http.ResponseWriter, req *http.Request) {
@@ -49,7 +173,7 @@ func (a *apiConfig) revokeRefreshTokenHandler(w http.ResponseWriter, req *http.R
 		return
 	}
 
-	refreshToken, err := a.dbQueries.GetUserByToken(req.Context(), token)
+	refreshToken, err := a.dbQueries.GetUserByToken(req.Context(), auth.HashRefreshToken(token))
 	if err != nil {
 		log.Printf("Error getting refresh token: %s", err)
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
@@ -61,7 +185,7 @@ func (a *apiConfig) revokeRefreshTokenHandler(w http.ResponseWriter, req *http.R
 		return
 	}
 
-	err = a.dbQueries.RevokeUserToken(req.Context(), refreshToken.Token)
+	err = a.dbQueries.RevokeUserToken(req.Context(), refreshToken.TokenHash)
 	if err != nil {
 		log.Printf("Error revoking refresh token: %s", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -70,3 +194,175 @@ func (a *apiConfig) revokeRefreshTokenHandler(w http.ResponseWriter, req *http.R
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// jwksHandler publishes the public keys access tokens can be verified with,
+// so other services don't need a shared secret.
+func (a *apiConfig) jwksHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(a.JWT.Keys.JWKS())
+}
+
+// authenticate resolves the user behind the request's bearer token. Access
+// tokens from a login can do anything the user can; personal access tokens
+// and tokens issued to OAuth clients must have been granted scope. Endpoints
+// that manage the account itself call authenticateSession instead so neither
+// kind of token can reach them.
+func (a *apiConfig) authenticate(req *http.Request, scope string) (uuid.UUID, error) {
+	userID, err := a.authenticateBearer(req, scope)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	err = a.requireWritableAccount(req.Context(), userID, scope)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	return userID, nil
+}
+
+// authenticateSession resolves the user behind an access token from a login,
+// for the endpoints that manage the account itself. Tokens delegated to an
+// OAuth client are refused with auth.ErrDelegatedToken. Access tokens outlive
+// the sessions revoked when deletion is requested, so accounts pending
+// deletion are refused here as well.
+func (a *apiConfig) authenticateSession(req *http.Request) (database.User, error) {
+	token, err := auth.GetBearerToken(req.Header)
+	if err != nil {
+		return database.User{}, err
+	}
+
+	userID, scopes, err := auth.ValidateJWT(token, a.JWT)
+	if err != nil {
+		return database.User{}, err
+	}
+	if scopes != nil {
+		return database.User{}, auth.ErrDelegatedToken
+	}
+
+	user, err := a.dbQueries.GetUserByID(req.Context(), userID)
+	if err != nil {
+		return database.User{}, err
+	}
+	if user.DeletionRequestedAt.Valid {
+		return database.User{}, errAccountPendingDeletion
+	}
+	return user, nil
+}
+
+// requireWritableAccount refuses write scopes to accounts that are pending
+// deletion, whose access tokens may outlive their revoked sessions, and to
+// unverified accounts when ReadOnlyUntilVerified is set.
+func (a *apiConfig) requireWritableAccount(ctx context.Context, userID uuid.UUID, scope string) error {
+	if !isWriteScope(scope) {
+		return nil
+	}
+
+	user, err := a.dbQueries.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.DeletionRequestedAt.Valid {
+		return errAccountPendingDeletion
+	}
+	if a.ReadOnlyUntilVerified && !user.EmailVerifiedAt.Valid {
+		return errEmailNotVerified
+	}
+	return nil
+}
+
+func (a *apiConfig) authenticateBearer(req *http.Request, scope string) (uuid.UUID, error) {
+	token, err := auth.GetBearerToken(req.Header)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	if !auth.IsPersonalAccessToken(token) {
+		userID, scopes, err := auth.ValidateJWT(token, a.JWT)
+		if err != nil {
+			return uuid.Nil, err
+		}
+		if scopes != nil {
+			err = auth.RequireScope(scopes, scope)
+			if err != nil {
+				return uuid.Nil, err
+			}
+		}
+		return userID, nil
+	}
+
+	pat, err := a.dbQueries.GetActivePersonalAccessToken(req.Context(), auth.HashPersonalAccessToken(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return uuid.Nil, auth.ErrUnknownToken
+	}
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	err = auth.RequireScope(pat.Scopes, scope)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	// last_used_at only needs to be roughly right, so a busy token updates
+	// it at most once a minute instead of writing on every request.
+	err = a.dbQueries.TouchPersonalAccessToken(req.Context(), pat.ID)
+	if err != nil {
+		log.Printf("Error updating personal access token last use: %s", err)
+	}
+
+	return pat.UserID, nil
+}
+
+// respondAuthError rejects a request whose bearer token is missing, invalid
+// or lacks a scope, describing the problem in a WWW-Authenticate challenge
+// (RFC 6750).
+func respondAuthError(w http.ResponseWriter, err error) {
+	challenge := `Bearer realm="chirpy"`
+
+	var scopeErr *auth.ScopeError
+	if errors.As(err, &scopeErr) {
+		challenge += fmt.Sprintf(`, error="insufficient_scope", scope=%q`, scopeErr.Scope)
+		w.Header().Set("WWW-Authenticate", challenge)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, errEmailNotVerified) {
+		http.Error(w, "Verify your email address before making changes", http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, errAccountPendingDeletion) {
+		http.Error(w, "Account is scheduled for deletion", http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, auth.ErrDelegatedToken) {
+		challenge += `, error="insufficient_scope", error_description="This endpoint requires a login session"`
+		w.Header().Set("WWW-Authenticate", challenge)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	var description string
+	switch {
+	case errors.Is(err, auth.ErrExpired):
+		description = "The access token expired"
+	case errors.Is(err, auth.ErrNotYetValid):
+		description = "The access token is not valid yet"
+	case errors.Is(err, auth.ErrInvalidSignature), errors.Is(err, auth.ErrInvalidAlgorithm), errors.Is(err, auth.ErrUnknownKey):
+		description = "The access token signature is invalid"
+	case errors.Is(err, auth.ErrInvalidIssuer), errors.Is(err, auth.ErrInvalidAudience):
+		description = "The access token was not issued for this service"
+	case errors.Is(err, auth.ErrMalformedToken):
+		description = "The access token is malformed"
+	case errors.Is(err, auth.ErrUnknownToken):
+		description = "The access token is unknown, revoked or expired"
+	}
+	if description != "" {
+		challenge += fmt.Sprintf(`, error="invalid_token", error_description=%q`, description)
+	}
+
+	w.Header().Set("WWW-Authenticate", challenge)
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/TheJa750/Chirpy/internal/auth"
+	"github.com/TheJa750/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const totpIssuer = "Chirpy"
+
+// verifySecondFactor accepts either a TOTP code that hasn't been used before
+// or an unused recovery code.
+func (a *apiConfig) verifySecondFactor(ctx context.Context, user database.User, code string) (bool, error) {
+	if step, ok := auth.ValidateTOTP(user.TotpSecret.String, code, time.Now()); ok {
+		used, err := a.dbQueries.UseTOTPStep(ctx, database.UseTOTPStepParams{
+			ID:           user.ID,
+			TotpLastStep: step,
+		})
+		if err != nil {
+			return false, err
+		}
+		return used == 1, nil
+	}
+
+	used, err := a.dbQueries.UseRecoveryCode(ctx, database.UseRecoveryCodeParams{
+		UserID:   user.ID,
+		CodeHash: auth.HashRecoveryCode(code),
+	})
+	if err != nil {
+		return false, err
+	}
+	return used == 1, nil
+}
+
+// replaceRecoveryCodes invalidates the user's recovery codes and issues a new
+// set.
+func (a *apiConfig) replaceRecoveryCodes(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	codes, err := auth.GenerateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	err = a.dbQueries.DeleteRecoveryCodes(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, code := range codes {
+		err = a.dbQueries.CreateRecoveryCode(ctx, database.CreateRecoveryCodeParams{
+			UserID:   userID,
+			CodeHash: auth.HashRecoveryCode(code),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return codes, nil
+}
+
+// respondWithLoginChallenge is sent instead of tokens when the password was
+// right but the user still has to prove they hold their second factor.
+func (a *apiConfig) respondWithLoginChallenge(w http.ResponseWriter, req *http.Request, user database.User) {
+	challengeToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		log.Printf("Error creating login challenge: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	challenge, err := a.dbQueries.CreateLoginChallenge(req.Context(), database.CreateLoginChallengeParams{
+		TokenHash: auth.HashRefreshToken(challengeToken),
+		UserID:    user.ID,
+	})
+	if err != nil {
+		log.Printf("Error saving login challenge: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(LoginChallenge{
+		TwoFactorRequired: true,
+		ChallengeToken:    challengeToken,
+		ExpiresAt:         challenge.ExpiresAt,
+	})
+}
+
+func (a *apiConfig) loginTwoFactorHandler(w http.ResponseWriter, req *http.Request) {
+	var loginReq LoginTwoFactorRequest
+	decoder := json.NewDecoder(req.Body)
+	err := decoder.Decode(&loginReq)
+	if err != nil {
+		log.Printf("Error decoding two-factor login request: %s", err)
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	// Each challenge allows a handful of attempts, so the six digit code
+	// can't be brute forced within its lifetime.
+	challengeHash := auth.HashRefreshToken(loginReq.ChallengeToken)
+	challenge, err := a.dbQueries.AttemptLoginChallenge(req.Context(), challengeHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Login challenge is invalid or expired", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting login challenge: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	user, err := a.dbQueries.GetUserByID(req.Context(), challenge.UserID)
+	if err != nil {
+		log.Printf("Error getting user by ID: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// The per-challenge limit alone would let a client holding the password
+	// start a fresh challenge after every few guesses, so codes also count
+	// against the same throttle as passwords.
+	if !a.startLoginAttempt(w, req, user.Email) {
+		return
+	}
+
+	ok, err := a.verifySecondFactor(req.Context(), user, loginReq.Code)
+	if err != nil {
+		log.Printf("Error verifying second factor: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		a.recordLoginFailure(req, user.Email, uuid.NullUUID{UUID: user.ID, Valid: true}, loginFailureWrongCode)
+		http.Error(w, "Invalid authentication code", http.StatusUnauthorized)
+		return
+	}
+
+	completed, err := a.dbQueries.CompleteLoginChallenge(req.Context(), challengeHash)
+	if err != nil {
+		log.Printf("Error completing login challenge: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if completed == 0 {
+		http.Error(w, "Login challenge is invalid or expired", http.StatusUnauthorized)
+		return
+	}
+
+	a.loginSucceeded(req, user.Email)
+	a.respondWithLogin(w, req, user)
+}
+
+// enrollTwoFactorHandler starts setting up an authenticator app. Turning on
+// a second factor takes the password, like turning it off, so a stolen access
+// token can't be used to lock the owner out with an attacker's authenticator.
+func (a *apiConfig) enrollTwoFactorHandler(w http.ResponseWriter, req *http.Request) {
+	var twoFactorReq TwoFactorRequest
+	decoder := json.NewDecoder(req.Body)
+	err := decoder.Decode(&twoFactorReq)
+	if err != nil {
+		log.Printf("Error decoding two-factor request: %s", err)
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	user, err := a.authenticateSession(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		respondAuthError(w, err)
+		return
+	}
+
+	if user.TotpEnabledAt.Valid {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	if !a.verifyCurrentCredentials(w, req, user, twoFactorReq.Password, "") {
+		return
+	}
+
+	// Starting over replaces any secret from an unfinished enrollment.
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		log.Printf("Error generating TOTP secret: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	err = a.dbQueries.SetPendingTOTPSecret(req.Context(), database.SetPendingTOTPSecretParams{
+		ID:         user.ID,
+		TotpSecret: sql.NullString{String: secret, Valid: true},
+	})
+	if err != nil {
+		log.Printf("Error saving TOTP secret: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(TwoFactorEnrollment{
+		Secret:     secret,
+		OTPAuthURI: auth.TOTPURI(secret, totpIssuer, user.Email),
+	})
+}
+
+func (a *apiConfig) confirmTwoFactorHandler(w http.ResponseWriter, req *http.Request) {
+	var twoFactorReq TwoFactorRequest
+	decoder := json.NewDecoder(req.Body)
+	err := decoder.Decode(&twoFactorReq)
+	if err != nil {
+		log.Printf("Error decoding two-factor request: %s", err)
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	user, err := a.authenticateSession(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		respondAuthError(w, err)
+		return
+	}
+
+	if user.TotpEnabledAt.Valid {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+	if !user.TotpSecret.Valid {
+		http.Error(w, "Start two-factor enrollment first", http.StatusBadRequest)
+		return
+	}
+
+	// The password is checked again because enrollment only saved a pending
+	// secret; this is the step that makes logins depend on it.
+	if !a.verifyCurrentCredentials(w, req, user, twoFactorReq.Password, "") {
+		return
+	}
+
+	// Confirming proves the authenticator app was set up correctly before
+	// logins start depending on it.
+	step, ok := auth.ValidateTOTP(user.TotpSecret.String, twoFactorReq.Code, time.Now())
+	if !ok {
+		http.Error(w, "Invalid authentication code", http.StatusBadRequest)
+		return
+	}
+
+	enabled, err := a.dbQueries.EnableTOTP(req.Context(), database.EnableTOTPParams{
+		ID:           user.ID,
+		TotpLastStep: step,
+	})
+	if err != nil {
+		log.Printf("Error enabling TOTP: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if enabled == 0 {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	codes, err := a.replaceRecoveryCodes(req.Context(), user.ID)
+	if err != nil {
+		log.Printf("Error creating recovery codes: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(RecoveryCodes{RecoveryCodes: codes})
+}
+
+func (a *apiConfig) regenerateRecoveryCodesHandler(w http.ResponseWriter, req *http.Request) {
+	var twoFactorReq TwoFactorRequest
+	decoder := json.NewDecoder(req.Body)
+	err := decoder.Decode(&twoFactorReq)
+	if err != nil {
+		log.Printf("Error decoding two-factor request: %s", err)
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	user, err := a.authenticateSession(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		respondAuthError(w, err)
+		return
+	}
+
+	if !user.TotpEnabledAt.Valid {
+		http.Error(w, "Two-factor authentication is not enabled", http.StatusBadRequest)
+		return
+	}
+
+	if !a.startLoginAttempt(w, req, user.Email) {
+		return
+	}
+
+	ok, err := a.verifySecondFactor(req.Context(), user, twoFactorReq.Code)
+	if err != nil {
+		log.Printf("Error verifying second factor: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		a.recordLoginFailure(req, user.Email, uuid.NullUUID{UUID: user.ID, Valid: true}, loginFailureWrongCode)
+		http.Error(w, "Invalid authentication code", http.StatusForbidden)
+		return
+	}
+
+	a.loginSucceeded(req, user.Email)
+
+	codes, err := a.replaceRecoveryCodes(req.Context(), user.ID)
+	if err != nil {
+		log.Printf("Error creating recovery codes: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(RecoveryCodes{RecoveryCodes: codes})
+}
+
+func (a *apiConfig) disableTwoFactorHandler(w http.ResponseWriter, req *http.Request) {
+	var twoFactorReq TwoFactorRequest
+	decoder := json.NewDecoder(req.Body)
+	err := decoder.Decode(&twoFactorReq)
+	if err != nil {
+		log.Printf("Error decoding two-factor request: %s", err)
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	user, err := a.authenticateSession(req)
+	if err != nil {
+		log.Printf("Error authenticating request: %s", err)
+		respondAuthError(w, err)
+		return
+	}
+
+	if !user.TotpEnabledAt.Valid {
+		http.Error(w, "Two-factor authentication is not enabled", http.StatusBadRequest)
+		return
+	}
+
+	// A stolen access token alone must not be enough to strip the second
+	// factor, so both the password and a code are required.
+	if !a.verifyCurrentCredentials(w, req, user, twoFactorReq.Password, twoFactorReq.Code) {
+		return
+	}
+
+	err = a.dbQueries.DisableTOTP(req.Context(), user.ID)
+	if err != nil {
+		log.Printf("Error disabling TOTP: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	err = a.dbQueries.DeleteRecoveryCodes(req.Context(), user.ID)
+	if err != nil {
+		log.Printf("Error deleting recovery codes: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
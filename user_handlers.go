@@ -1,15 +1,63 @@
 package main
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/TheJa750/Chirpy/internal/auth"
 	"github.com/TheJa750/Chirpy/internal/database"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+var handlePattern = regexp.MustCompile(`^[a-z0-9_]{3,30}$`)
+
+// normalizeHandle lower-cases a requested handle and checks it can be
+// mentioned in a chirp. An empty handle gets a generated placeholder the user
+// can change later.
+func normalizeHandle(handle string) (string, error) {
+	if handle == "" {
+		return "user_" + strings.ReplaceAll(uuid.NewString(), "-", "")[:12], nil
+	}
+
+	handle = strings.ToLower(strings.TrimPrefix(handle, "@"))
+	if !handlePattern.MatchString(handle) {
+		return "", errors.New("handle must be 3-30 letters, digits or underscores")
+	}
+	return handle, nil
+}
+
+// isUniqueViolation reports whether err is a unique constraint failure on the
+// named constraint.
+func isUniqueViolation(err error, constraint string) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == constraint
+}
+
+// rejectWeakPassword checks a new password against the policy and, if it
+// fails, writes a 400 listing every rule it broke. It reports whether the
+// request was rejected.
+func (a *apiConfig) rejectWeakPassword(w http.ResponseWriter, password string) bool {
+	violations := a.PasswordPolicy.Validate(password)
+	if len(violations) == 0 {
+		return false
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(PasswordPolicyError{
+		Message:    "Password does not meet the password policy",
+		Violations: violations,
+	})
+	return true
+}
+
 func (a *apiConfig) createUserHandler(w http.ResponseWriter, req *http.Request) {
 	var userReq UserRequest
 	decoder := json.NewDecoder(req.Body)
@@ -30,7 +78,17 @@ func (a *apiConfig) createUserHandler(w http.ResponseWriter, req *http.Request)
 		return
 	}
 
-	hashedPassword, err := auth.HashPassword(userReq.Password)
+	if a.rejectWeakPassword(w, userReq.Password) {
+		return
+	}
+
+	handle, err := normalizeHandle(userReq.Handle)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	hashedPassword, err := a.Passwords.Hash(userReq.Password)
 	if err != nil {
 		log.Printf("Error hashing password: %s", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -39,19 +97,34 @@ func (a *apiConfig) createUserHandler(w http.ResponseWriter, req *http.Request)
 
 	user, err := a.dbQueries.CreateUser(req.Context(), database.CreateUserParams{
 		Email:          userReq.Email,
-		HashedPassword: hashedPassword})
+		HashedPassword: hashedPassword,
+		Handle:         handle,
+	})
+	if isUniqueViolation(err, "users_handle_key") {
+		http.Error(w, "Handle is already taken", http.StatusConflict)
+		return
+	}
 	if err != nil {
 		log.Printf("Error creating user: %s", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
+	// The account is usable straight away; failing to send the email only
+	// means the user has to ask for another one.
+	err = a.sendVerificationEmail(req.Context(), user.ID, user.Email)
+	if err != nil {
+		log.Printf("Error sending verification email: %s", err)
+	}
+
 	jsonUser := User{
-		ID:        user.ID,
-		CreatedAt: user.CreatedAt.Time,
-		UpdatedAt: user.UpdatedAt.Time,
-		Email:     user.Email,
-		ChirpyRed: user.IsChirpyRed,
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt.Time,
+		UpdatedAt:     user.UpdatedAt.Time,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+		Handle:        user.Handle,
+		ChirpyRed:     user.IsChirpyRed,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -74,52 +147,108 @@ func (a *apiConfig) loginUserHandler(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	// Throttling is checked before the password so a blocked client learns
+	// nothing from its guesses.
+	if !a.startLoginAttempt(w, req, userReq.Email) {
+		return
+	}
+
 	user, err := a.dbQueries.GetUserByEmail(req.Context(), userReq.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		a.recordLoginFailure(req, userReq.Email, uuid.NullUUID{}, loginFailureUnknownEmail)
+		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
+		return
+	}
 	if err != nil {
 		log.Printf("Error getting user by email: %s", err)
-		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	err = auth.CheckPasswordHash(user.HashedPassword, userReq.Password)
+	err = a.Passwords.Verify(user.HashedPassword, userReq.Password)
 	if err != nil {
 		log.Printf("Password check failed: %s", err)
+		a.recordLoginFailure(req, userReq.Email, uuid.NullUUID{UUID: user.ID, Valid: true}, loginFailureWrongPassword)
 		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
 		return
 	}
 
-	access_token, err := auth.MakeJWT(user.ID, a.JWTSecret, 3600*time.Second)
-	if err != nil {
-		log.Printf("Error creating JWT: %s", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	// With a second factor the password alone isn't a successful login, so
+	// the failures against the email are only forgotten once the code is
+	// checked too. The IP's attempt was a right password either way.
+	if user.TotpEnabledAt.Valid {
+		a.releaseAttempt(req.Context(), ipThrottleSubject(clientIP(req)))
+	} else {
+		a.loginSucceeded(req, userReq.Email)
+	}
+
+	if user.DeletionRequestedAt.Valid {
+		http.Error(w, "Account is scheduled for deletion; cancel the deletion to log in again", http.StatusForbidden)
 		return
 	}
 
-	rtString, err := auth.MakeRefreshToken()
+	// Login is the only time the plain password is available, so hashes made
+	// with bcrypt or older argon2id parameters are replaced here. The update
+	// only applies if the hash is still the one just checked, so a password
+	// changed in the meantime isn't overwritten with the old one. Failing to
+	// upgrade shouldn't stop the user logging in.
+	if a.Passwords.NeedsRehash(user.HashedPassword) {
+		hashedPassword, err := a.Passwords.Hash(userReq.Password)
+		if err == nil {
+			err = a.dbQueries.UpgradeUserPasswordHash(req.Context(), database.UpgradeUserPasswordHashParams{
+				ID:      user.ID,
+				OldHash: user.HashedPassword,
+				NewHash: hashedPassword,
+			})
+		}
+		if err != nil {
+			log.Printf("Error upgrading password hash: %s", err)
+		}
+	}
+
+	if user.TotpEnabledAt.Valid {
+		a.respondWithLoginChallenge(w, req, user)
+		return
+	}
+
+	a.respondWithLogin(w, req, user)
+}
+
+// respondWithLogin starts a session for a user who has fully authenticated
+// and returns their access and refresh tokens.
+func (a *apiConfig) respondWithLogin(w http.ResponseWriter, req *http.Request, user database.User) {
+	// Every way of logging in ends here, so this is where a disabled account
+	// is stopped from getting a session.
+	if user.DeletionRequestedAt.Valid {
+		http.Error(w, "Account is scheduled for deletion; cancel the deletion to log in again", http.StatusForbidden)
+		return
+	}
+
+	access_token, err := auth.MakeJWT(user.ID, a.JWT, 3600*time.Second)
 	if err != nil {
-		log.Printf("Error creating refresh token: %s", err)
+		log.Printf("Error creating JWT: %s", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	_, err = a.dbQueries.CreateUserToken(req.Context(), database.CreateUserTokenParams{
-		Token:  rtString,
-		UserID: user.ID,
-	})
+	rtString, err := a.createSession(req, user.ID)
 	if err != nil {
-		log.Printf("Error creating refresh token in database: %s", err)
+		log.Printf("Error creating session: %s", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
 	jsonUser := User{
-		ID:           user.ID,
-		CreatedAt:    user.CreatedAt.Time,
-		UpdatedAt:    user.UpdatedAt.Time,
-		Email:        user.Email,
-		AccessToken:  access_token,
-		RefreshToken: rtString,
-		ChirpyRed:    user.IsChirpyRed,
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt.Time,
+		UpdatedAt:     user.UpdatedAt.Time,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+		PendingEmail:  user.PendingEmail.String,
+		Handle:        user.Handle,
+		AccessToken:   access_token,
+		RefreshToken:  rtString,
+		ChirpyRed:     user.IsChirpyRed,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -127,69 +256,121 @@ func (a *apiConfig) loginUserHandler(w http.ResponseWriter, req *http.Request) {
 	json.NewEncoder(w).Encode(jsonUser)
 }
 
+// updateUserHandler changes the account email, password or both. Either
+// change needs the current password or a recent-auth token, so a stolen
+// access token alone can't take over the account.
 func (a *apiConfig) updateUserHandler(w http.ResponseWriter, req *http.Request) {
-	token, err := auth.GetBearerToken(req.Header)
+	user, err := a.authenticateSession(req)
 	if err != nil {
-		log.Printf("Error getting bearer token: %s", err)
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		log.Printf("Error authenticating request: %s", err)
+		respondAuthError(w, err)
 		return
 	}
 
-	userID, err := auth.ValidateJWT(token, a.JWTSecret)
+	var updateReq AccountUpdateRequest
+	decoder := json.NewDecoder(req.Body)
+	err = decoder.Decode(&updateReq)
 	if err != nil {
-		log.Printf("Error validating JWT: %s", err)
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		log.Printf("Error decoding account update request: %s", err)
+		http.Error(w, "Invalid request", http.StatusBadRequest)
 		return
 	}
 
-	var userReq UserRequest
-	decoder := json.NewDecoder(req.Body)
-	err = decoder.Decode(&userReq)
-	if err != nil {
-		log.Printf("Error decoding user request: %s", err)
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+	if updateReq.Email == "" && updateReq.Password == "" {
+		http.Error(w, "Email or password is required", http.StatusBadRequest)
 		return
 	}
 
-	if userReq.Email == "" {
-		http.Error(w, "Email is required", http.StatusBadRequest)
+	if updateReq.Password != "" && a.rejectWeakPassword(w, updateReq.Password) {
 		return
 	}
 
-	if userReq.Password == "" {
-		http.Error(w, "Password is required", http.StatusBadRequest)
+	if !a.requireRecentAuth(w, req, user, updateReq) {
+		return
+	}
+
+	if updateReq.Email != "" {
+		if updateReq.Email != user.Email {
+			_, err = a.dbQueries.GetUserByEmail(req.Context(), updateReq.Email)
+			if err == nil {
+				http.Error(w, "Email is already in use", http.StatusConflict)
+				return
+			}
+			if !errors.Is(err, sql.ErrNoRows) {
+				log.Printf("Error getting user by email: %s", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		// A new email address is only recorded as pending. The account keeps
+		// its current address until the new one is confirmed through the
+		// link sent to it.
+		previousPending := user.PendingEmail
+		user, err = a.dbQueries.UpdateUserEmail(req.Context(), database.UpdateUserEmailParams{
+			ID:    user.ID,
+			Email: updateReq.Email,
+		})
+		if err != nil {
+			log.Printf("Error updating email: %s", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		if user.PendingEmail.Valid && user.PendingEmail != previousPending {
+			err = a.sendVerificationEmail(req.Context(), user.ID, user.PendingEmail.String)
+			if err != nil {
+				log.Printf("Error sending verification email: %s", err)
+			}
+		}
+	}
+
+	if updateReq.Password == "" {
+		jsonUser := User{
+			ID:            user.ID,
+			CreatedAt:     user.CreatedAt.Time,
+			UpdatedAt:     user.UpdatedAt.Time,
+			Email:         user.Email,
+			EmailVerified: user.EmailVerifiedAt.Valid,
+			PendingEmail:  user.PendingEmail.String,
+			Handle:        user.Handle,
+			ChirpyRed:     user.IsChirpyRed,
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(jsonUser)
 		return
 	}
 
-	hashedPassword, err := auth.HashPassword(userReq.Password)
+	hashedPassword, err := a.Passwords.Hash(updateReq.Password)
 	if err != nil {
 		log.Printf("Error hashing password: %s", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	user, err := a.dbQueries.UpdateUser(req.Context(), database.UpdateUserParams{
-		ID:             userID,
-		Email:          userReq.Email,
+	err = a.dbQueries.UpdateUserPassword(req.Context(), database.UpdateUserPasswordParams{
+		ID:             user.ID,
 		HashedPassword: hashedPassword,
 	})
 	if err != nil {
-		log.Printf("Error updating user: %s", err)
+		log.Printf("Error updating password: %s", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	jsonUser := User{
-		ID:        user.ID,
-		CreatedAt: user.CreatedAt.Time,
-		UpdatedAt: user.UpdatedAt.Time,
-		Email:     user.Email,
-		ChirpyRed: user.IsChirpyRed,
+	// A password change signs out every session, token and app. Access
+	// tokens don't say which session they came from, so the caller is handed
+	// a fresh session in the response instead of keeping their old one.
+	err = revokeAllCredentials(req.Context(), a.dbQueries, user.ID)
+	if err != nil {
+		log.Printf("Error revoking user sessions: %s", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(jsonUser)
+	a.respondWithLogin(w, req, user)
 }
 
 func (a *apiConfig) upgradeUserHandler(w http.ResponseWriter, req *http.Request) {